@@ -22,13 +22,15 @@ type Client struct {
 	// - []string: 多点地址列表
 	// - client.Selector: 自定义选择器
 	// - client.SelectMode: 选择模式
-	ServicePath string // 服务路径
+	ServicePath string          // 服务路径
+	Message     chan<- *Message // 双向通信时接收服务器推送的通道，为空时使用普通模式
 }
 
 // start 启动客户端
 // 1. 原子操作检查并设置启动状态
 // 2. 根据 Selector 类型选择不同的服务发现模式
 // 3. 初始化对应的 XClient
+// 4. 设置认证令牌
 func (this *Client) start() (err error) {
 	if !atomic.CompareAndSwapInt32(&this.started, 0, 1) {
 		return fmt.Errorf("client started:%v", this.ServicePath)
@@ -54,9 +56,23 @@ func (this *Client) start() (err error) {
 	default:
 		err = fmt.Errorf("XClient AddServicePath arg(selector) type error:%v", this.Selector)
 	}
+	if err == nil {
+		if token := cosrpc.Token(this.ServicePath); token != "" {
+			this.client.Auth(token)
+		}
+	}
 	return
 }
 
+// newXClient 创建 XClient，设置了 Message 时使用双向通信模式
+func (this *Client) newXClient(selectMode client.SelectMode, dis client.ServiceDiscovery) client.XClient {
+	setErrorFunc()
+	if this.Message != nil {
+		return client.NewBidirectionalXClient(this.ServicePath, this.FailMode, selectMode, dis, this.Option, this.Message)
+	}
+	return client.NewXClient(this.ServicePath, this.FailMode, selectMode, dis, this.Option)
+}
+
 // close 关闭客户端
 func (this *Client) close() error {
 	return this.client.Close()
@@ -69,7 +85,7 @@ func (this *Client) Peer2Peer(address string) error {
 	if err != nil {
 		return err
 	}
-	this.client = client.NewXClient(this.ServicePath, this.FailMode, client.RandomSelect, dis, this.Option)
+	this.client = this.newXClient(client.RandomSelect, dis)
 	return nil
 }
 
@@ -85,7 +101,7 @@ func (this *Client) Multiple(address []string) error {
 		return err
 	}
 
-	this.client = client.NewXClient(this.ServicePath, this.FailMode, client.RandomSelect, dis, this.Option)
+	this.client = this.newXClient(client.RandomSelect, dis)
 	return nil
 }
 
@@ -100,7 +116,7 @@ func (this *Client) Registry(selectMod client.SelectMode, selector client.Select
 		return err
 	}
 
-	this.client = client.NewXClient(this.ServicePath, this.FailMode, selectMod, dis, this.Option)
+	this.client = this.newXClient(selectMod, dis)
 	if selectMod == client.SelectByUser && selector != nil {
 		this.client.SetSelector(selector)
 	}
@@ -0,0 +1,83 @@
+package client_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/cosrpc/client"
+	"github.com/hwcer/cosrpc/cosrpctest"
+	"github.com/hwcer/cosrpc/server"
+	"github.com/smallnest/rpcx/share"
+)
+
+type bulkReply struct {
+	Text string `json:"text"`
+}
+
+// bulk 返回超过压缩阈值的响应
+func bulk(c *cosrpc.Context) any {
+	return &bulkReply{Text: strings.Repeat("cosrpc ", 1024)}
+}
+
+// acceptGzip 请求 metadata 声明接受 gzip，返回的 map 接收响应 metadata
+func acceptGzip() (context.Context, map[string]string) {
+	res := map[string]string{}
+	ctx := context.WithValue(context.Background(), share.ReqMetaDataKey, map[string]string{cosrpc.MetaDataAcceptCompress: cosrpc.CompressGzip})
+	return context.WithValue(ctx, share.ResMetaDataKey, res), res
+}
+
+func TestCompress(t *testing.T) {
+	ts := cosrpctest.New(t)
+	if err := ts.Service("bulk").Register(bulk, "/get"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, res := acceptGzip()
+	reply, err := cosrpctest.Invoke[bulkReply](ctx, ts, "bulk", "/get", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Text != bulk(nil).(*bulkReply).Text {
+		t.Errorf("reply length = %v, want the decompressed reply", len(reply.Text))
+	}
+	if res[cosrpc.MetaDataCompress] != cosrpc.CompressGzip {
+		t.Errorf("response metadata %v = %q, want the reply compressed with gzip", cosrpc.MetaDataCompress, res[cosrpc.MetaDataCompress])
+	}
+	calls := ts.Calls()
+	if len(calls) != 1 || calls[0].Metadata[cosrpc.MetaDataAcceptCompress] != cosrpc.CompressGzip {
+		t.Errorf("server did not receive %v", cosrpc.MetaDataAcceptCompress)
+	}
+}
+
+// in-process 模式不压缩，也不向服务端传递 MetaDataAcceptCompress
+func TestCompressInProcess(t *testing.T) {
+	name := "compress-inprocess"
+	var accept string
+	get := func(c *cosrpc.Context) any {
+		accept = c.GetMetadata(cosrpc.MetaDataAcceptCompress)
+		return bulk(c)
+	}
+	if err := server.Default.Service(name).Register(get, "/get"); err != nil {
+		t.Fatal(err)
+	}
+	m := client.NewManager()
+	if err := m.Add(name, cosrpc.SelectorTypeProcess); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	ctx, res := acceptGzip()
+	reply, err := client.InvokeWith[bulkReply](ctx, m, name, "/get", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Text != bulk(nil).(*bulkReply).Text {
+		t.Errorf("reply length = %v, want the original reply", len(reply.Text))
+	}
+	if accept != "" || res[cosrpc.MetaDataCompress] != "" {
+		t.Errorf("accept = %q, compress = %q, want no compression in-process", accept, res[cosrpc.MetaDataCompress])
+	}
+}
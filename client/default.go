@@ -2,11 +2,10 @@ package client
 
 import (
 	"context"
-	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/cosrpc/server"
 	"github.com/hwcer/logger"
 	"github.com/smallnest/rpcx/client"
 	"reflect"
-	"time"
 )
 
 type Caller = client.Call
@@ -30,10 +29,6 @@ func SetDiscovery(d discovery) {
 	discoveryDefault = d
 }
 
-func ping(c *cosrpc.Context) interface{} {
-	return time.Now().Unix()
-}
-
 func Call(ctx context.Context, servicePath, serviceMethod string, args, reply any) (err error) {
 	return Manage.Call(ctx, servicePath, serviceMethod, args, reply)
 }
@@ -50,9 +45,27 @@ func Async(ctx context.Context, servicePath, serviceMethod string, args any) (ca
 func CallWithMetadata(req, res map[string]string, servicePath, serviceMethod string, args, reply any) (err error) {
 	return Manage.CallWithMetadata(req, res, servicePath, serviceMethod, args, reply)
 }
+
+// Ping 调用内置服务 _cosrpc/ping 返回节点当前时间，需要服务端开启 Server.Introspection
+// 通过 metadata 中的 selector.MetaDataAddress 可以指定节点
+func Ping(ctx context.Context) (t int64, err error) {
+	err = Manage.XCall(ctx, server.IntrospectionService, "/ping", nil, &t)
+	return
+}
+
+// Subscribe 订阅服务器推送，参见 Server.Push
+func Subscribe(servicePath, serviceMethod string, handler PushHandler) {
+	Manage.Subscribe(servicePath, serviceMethod, handler)
+}
+
 func Broadcast(ctx context.Context, servicePath, serviceMethod string, args, reply any) (err error) {
 	return Manage.Broadcast(ctx, servicePath, serviceMethod, args, reply)
 }
 func WithTimeout(req, res map[string]string) (context.Context, context.CancelFunc) {
 	return Manage.WithTimeout(req, res)
 }
+
+// Idempotent 为请求设置幂等键，参见 clients.Idempotent
+func Idempotent(ctx context.Context, key ...string) context.Context {
+	return Manage.Idempotent(ctx, key...)
+}
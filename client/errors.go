@@ -0,0 +1,59 @@
+package client
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/hwcer/cosrpc"
+	"github.com/smallnest/rpcx/client"
+	"github.com/smallnest/rpcx/protocol"
+)
+
+var errorFuncOnce sync.Once
+
+// setErrorFunc 创建第一个 rpcx 客户端时设置 rpcx client.ClientErrorFunc，只设置一次
+// 只解析携带 cosrpc.MetaDataError 的响应，其他响应交给之前设置的 ClientErrorFunc 或 rpcx 默认处理，
+// 同一进程中访问其他 rpcx 服务的客户端不受影响
+func setErrorFunc() {
+	errorFuncOnce.Do(func() {
+		prev := client.ClientErrorFunc
+		client.ClientErrorFunc = func(res *protocol.Message, e string) client.ServiceError {
+			if _, ok := res.Metadata[cosrpc.MetaDataError]; ok {
+				return cosrpc.ParseError(res.Metadata, e)
+			}
+			if prev != nil {
+				return prev(res, e)
+			}
+			return client.NewServiceError(e)
+		}
+	})
+}
+
+// RateLimitError 请求被服务端限流
+// 可以通过 errors.As 判断，也可以通过 errors.As 获取 *cosrpc.Error
+type RateLimitError struct {
+	Err *cosrpc.Error
+}
+
+func (e *RateLimitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// rateLimited 错误码为 cosrpc.ErrCodeRateLimit 时转换为 *RateLimitError
+func rateLimited(err error) error {
+	var e *cosrpc.Error
+	if errors.As(err, &e) && e.Code == cosrpc.ErrCodeRateLimit {
+		return &RateLimitError{Err: e}
+	}
+	return err
+}
+
+// retryable 并发达到上限和限流的错误，节点本身可用，Failover 模式重新选择节点重试
+func retryable(err error) bool {
+	var e *cosrpc.Error
+	return errors.As(err, &e) && (e.Code == cosrpc.ErrCodeServiceBusy || e.Code == cosrpc.ErrCodeRateLimit)
+}
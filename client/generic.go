@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hwcer/cosrpc"
+)
+
+// Invoke 发起强类型调用
+// 请求使用协商后的 Binder 序列化，响应解码到 Resp，错误都可以通过 errors.As 获取 *cosrpc.Error，被限流时为 *RateLimitError，
+// 超时、连接断开等网络错误使用 ErrCodeInternal，原始错误保留在错误链中，可以通过 errors.Is 判断
+// 与 XCall 一致，网络、多地址、服务发现和进程内模式行为相同
+// Resp 为 []byte 时与 XCall 相同，返回未解析 values.Message 的原始响应体，响应中的错误码不会转换为错误
+//
+//	reply, err := client.Invoke[LoginReply](ctx, "user", "/login", &LoginArgs{})
+func Invoke[Resp any](ctx context.Context, servicePath, serviceMethod string, req any) (*Resp, error) {
+	return InvokeWith[Resp](ctx, &Manage, servicePath, serviceMethod, req)
+}
+
+// InvokeWith 使用指定的客户端管理器发起强类型调用，参见 Invoke
+func InvokeWith[Resp any](ctx context.Context, m *Manager, servicePath, serviceMethod string, req any) (*Resp, error) {
+	reply := new(Resp)
+	if err := m.XCall(ctx, servicePath, serviceMethod, req, reply); err != nil {
+		// 已经包含 *cosrpc.Error 的错误(如 *RateLimitError)原样返回，errors.As 可以获取具体类型
+		var e *cosrpc.Error
+		if errors.As(err, &e) {
+			return nil, err
+		}
+		return nil, cosrpc.AsError(err)
+	}
+	return reply, nil
+}
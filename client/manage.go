@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hwcer/cosgo"
 	"github.com/hwcer/cosgo/binder"
@@ -14,6 +15,7 @@ import (
 	"github.com/hwcer/cosgo/scc"
 	"github.com/hwcer/cosgo/values"
 	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/cosrpc/inprocess"
 	"github.com/hwcer/logger"
 	"github.com/smallnest/rpcx/client"
 	"github.com/smallnest/rpcx/protocol"
@@ -22,11 +24,23 @@ import (
 
 var Manage = clients{}
 
+// Manager 客户端管理器，Manage 为全局实例
+type Manager = clients
+
+// NewManager 创建独立的客户端管理器，不读取 cosrpc.Service 配置，也不响应 cosgo 生命周期事件
+// 通过 Add 添加服务，用于测试或同一进程内连接多套集群
+// 未通过 Add 添加的服务不会回退到服务发现，调用时返回 cosrpc.ErrCodeServiceNotFound
+func NewManager() *Manager {
+	return &Manager{dict: make(map[string]*Client), isolated: true}
+}
+
 // Discovery 注册中心服务发现,点对点或者点对多时无需设置
 
 type clients struct {
-	dict  map[string]*Client
-	mutex sync.Mutex
+	subscriber
+	dict     map[string]*Client
+	mutex    sync.Mutex
+	isolated bool //NewManager 创建的独立管理器，只使用 Add 添加的服务
 }
 
 func init() {
@@ -43,7 +57,11 @@ func (xc *clients) addServicePath(servicePath string, selector any) (c *Client,
 	c.FailMode = client.Failover
 	c.Selector = selector
 	c.ServicePath = servicePath
+	c.Message = xc.channel()
 	c.Option.SerializeType = protocol.SerializeNone
+	if c.Option.TLSConfig, err = cosrpc.ClientTLSConfig(); err != nil {
+		return
+	}
 	err = c.start()
 	return
 }
@@ -73,10 +91,21 @@ func (xc *clients) reload() (err error) {
 			return
 		}
 	}
-	Manage.dict = cs
+	xc.dict = cs
 	return
 }
 
+// Add 添加服务客户端，selector 与 cosrpc.Service 配置的值相同，也可以是 client.Selector 或 client.SelectMode
+func (xc *clients) Add(servicePath string, selector any) error {
+	_, err := xc.load(servicePath, selector)
+	return err
+}
+
+// Close 关闭所有客户端
+func (xc *clients) Close() error {
+	return xc.close()
+}
+
 func (xc *clients) Has(servicePath string) bool {
 	_, ok := xc.dict[servicePath]
 	return ok
@@ -86,6 +115,8 @@ func (xc *clients) Get(servicePath string) (c client.XClient) {
 	var err error
 	if cs := xc.dict[servicePath]; cs != nil {
 		c = cs.client
+	} else if xc.isolated {
+		return nil
 	} else if cs, err = xc.load(servicePath, cosrpc.SelectorTypeDiscovery); err == nil {
 		c = cs.client
 	} else {
@@ -117,30 +148,82 @@ func (xc *clients) WithTimeout(req, res map[string]string) (context.Context, con
 	return ctx, cancel
 }
 
-func (xc *clients) Call(ctx context.Context, servicePath, serviceMethod string, args, reply any) error {
-	c := xc.Get(servicePath)
-	if c == nil {
-		return fmt.Errorf("can not found any client:%s", servicePath)
+// Idempotent 为请求设置幂等键，key 为空时随机生成
+// 返回的 ctx 在 Failover 重试时使用同一个幂等键，服务端启用 Idempotency 后不会重复执行
+// ctx 为空时使用 context.Background()，需要超时时先调用 WithTimeout
+func (xc *clients) Idempotent(ctx context.Context, key ...string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	k := ""
+	if len(key) > 0 {
+		k = key[0]
+	}
+	if k == "" {
+		k = cosrpc.NewIdempotencyKey()
+	}
+	src, _ := ctx.Value(share.ReqMetaDataKey).(map[string]string)
+	req := make(map[string]string, len(src)+1)
+	for i, v := range src {
+		req[i] = v
 	}
+	req[cosrpc.MetaDataIdempotency] = k
+	return context.WithValue(ctx, share.ReqMetaDataKey, req)
+}
+
+func (xc *clients) Call(ctx context.Context, servicePath, serviceMethod string, args, reply any) (err error) {
 	if ctx == nil {
 		var cancel context.CancelFunc
 		ctx, cancel = scc.WithTimeout(cosrpc.Timeout())
 		defer cancel()
 	}
+	ctx, span := trace(ctx, servicePath, serviceMethod)
+	start := time.Now()
+	defer func() {
+		span.Finish(err)
+		observe(ctx, servicePath, serviceMethod, start, err, payloadSize(args), payloadSize(reply))
+	}()
+	return xc.call(ctx, servicePath, serviceMethod, args, reply)
+}
+
+// call 发起调用
+// Failover 模式下并发达到上限或限流时重新选择节点，最多重试 Option.Retries 次，
+// 这些错误不交给 rpcx 重试，rpcx 重试前会关闭连接并中断其上的其他请求
+func (xc *clients) call(ctx context.Context, servicePath, serviceMethod string, args, reply any) (err error) {
+	c := xc.Get(servicePath)
+	if c == nil {
+		return cosrpc.NewError(cosrpc.ErrCodeServiceNotFound, "can not found any client:"+servicePath)
+	}
 	serviceMethod = registry.Join(serviceMethod)
-	return c.Call(ctx, serviceMethod, args, reply)
+	retries := 0
+	if cs := xc.dict[servicePath]; cs != nil && cs.FailMode == client.Failover {
+		if _, ok := c.(*inprocess.Client); !ok {
+			retries = cs.Option.Retries
+		}
+	}
+	for {
+		err = c.Call(ctx, serviceMethod, args, reply)
+		if retries <= 0 || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+		retries--
+	}
 }
 
 func (xc *clients) Broadcast(ctx context.Context, servicePath, serviceMethod string, args, reply any) (err error) {
 	c := xc.Get(servicePath)
 	if c == nil {
-		return fmt.Errorf("can not found any client:%v", servicePath)
+		return cosrpc.NewError(cosrpc.ErrCodeServiceNotFound, "can not found any client:"+servicePath)
 	}
 	if ctx == nil {
 		var cancel context.CancelFunc
 		ctx, cancel = xc.WithTimeout(nil, nil)
 		defer cancel()
 	}
+	ctx, span := trace(ctx, servicePath, serviceMethod)
+	defer func() {
+		span.Finish(err)
+	}()
 	serviceMethod = registry.Join(serviceMethod)
 	var data []byte
 	if v, ok := args.([]byte); ok {
@@ -167,6 +250,18 @@ func (xc *clients) XCall(ctx context.Context, servicePath, serviceMethod string,
 	if reply != nil && reflect.TypeOf(reply).Kind() != reflect.Ptr {
 		return errors.New("client.call reply must pointer")
 	}
+	if ctx == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = scc.WithTimeout(cosrpc.Timeout())
+		defer cancel()
+	}
+	ctx, span := trace(ctx, servicePath, serviceMethod)
+	start := time.Now()
+	var reqSize, resSize int
+	defer func() {
+		span.Finish(err)
+		observe(ctx, servicePath, serviceMethod, start, err, reqSize, resSize)
+	}()
 	var data []byte
 	if v, ok := args.([]byte); ok {
 		data = v
@@ -176,15 +271,28 @@ func (xc *clients) XCall(ctx context.Context, servicePath, serviceMethod string,
 	if err != nil {
 		return err
 	}
-	if _, ok := reply.(*[]byte); ok {
-		if err = xc.Call(ctx, servicePath, serviceMethod, data, reply); err != nil {
-			return err
-		} else {
-			return nil
+	if limit := cosrpc.MaxPayload(servicePath); limit > 0 && len(data) > limit {
+		return cosrpc.ErrPayloadTooLarge
+	}
+	if ctx, data, err = xc.compress(ctx, servicePath, data); err != nil {
+		return err
+	}
+	ctx, res := xc.response(ctx)
+	reqSize = len(data)
+	if r, ok := reply.(*[]byte); ok {
+		if err = xc.call(ctx, servicePath, serviceMethod, data, reply); err != nil {
+			return rateLimited(err)
 		}
+		resSize = len(*r)
+		*r, err = xc.decompress(res, *r)
+		return err
 	}
 	v := make([]byte, 0)
-	if err = xc.Call(ctx, servicePath, serviceMethod, data, &v); err != nil {
+	if err = xc.call(ctx, servicePath, serviceMethod, data, &v); err != nil {
+		return rateLimited(err)
+	}
+	resSize = len(v)
+	if v, err = xc.decompress(res, v); err != nil {
 		return err
 	}
 	if len(v) == 0 {
@@ -194,14 +302,85 @@ func (xc *clients) XCall(ctx context.Context, servicePath, serviceMethod string,
 	if err = xc.Binder(ctx, binder.HeaderAccept, binder.HeaderContentType).Unmarshal(v, msg); err != nil {
 		return err
 	}
+	if msg.Code != 0 {
+		return rateLimited(xc.error(res, msg))
+	}
 	if reply != nil {
 		err = msg.Unmarshal(reply)
-	} else if msg.Code != 0 {
-		err = msg
 	}
 	return err
 }
 
+// compress 按请求 metadata 中的 MetaDataAcceptCompress 或服务配置压缩请求体
+// 压缩时复制请求 metadata 并在其中声明期望的响应压缩算法
+// in-process 模式不压缩，复制请求 metadata 并删除其中的 MetaDataAcceptCompress，避免服务端压缩响应
+func (xc *clients) compress(ctx context.Context, servicePath string, data []byte) (context.Context, []byte, error) {
+	req, _ := ctx.Value(share.ReqMetaDataKey).(map[string]string)
+	if _, ok := xc.Get(servicePath).(*inprocess.Client); ok {
+		if _, ok = req[cosrpc.MetaDataAcceptCompress]; ok {
+			meta := make(map[string]string, len(req))
+			for k, v := range req {
+				meta[k] = v
+			}
+			delete(meta, cosrpc.MetaDataAcceptCompress)
+			ctx = context.WithValue(ctx, share.ReqMetaDataKey, meta)
+		}
+		return ctx, data, nil
+	}
+	name := req[cosrpc.MetaDataAcceptCompress]
+	if name == "" {
+		name = cosrpc.Compression(servicePath)
+	}
+	if name == "" || name == cosrpc.CompressNone {
+		return ctx, data, nil
+	}
+	meta := make(map[string]string, len(req)+2)
+	for k, v := range req {
+		meta[k] = v
+	}
+	meta[cosrpc.MetaDataAcceptCompress] = name
+	delete(meta, cosrpc.MetaDataCompress)
+	if cosrpc.Compressible(data) {
+		zip, err := cosrpc.Compress(name, data)
+		if err != nil {
+			return ctx, nil, err
+		}
+		data = zip
+		meta[cosrpc.MetaDataCompress] = name
+	}
+	return context.WithValue(ctx, share.ReqMetaDataKey, meta), data, nil
+}
+
+// response 返回用于接收响应 metadata 的 map，调用方未提供时创建
+// 清除上一次调用留下的压缩标记、错误和服务端地址，用于读取响应使用的压缩算法、错误详情和慢调用日志的对端地址
+func (xc *clients) response(ctx context.Context) (context.Context, map[string]string) {
+	res, _ := ctx.Value(share.ResMetaDataKey).(map[string]string)
+	if res == nil {
+		res = make(map[string]string)
+		return context.WithValue(ctx, share.ResMetaDataKey, res), res
+	}
+	delete(res, cosrpc.MetaDataCompress)
+	delete(res, cosrpc.MetaDataError)
+	delete(res, share.ServerAddress)
+	return ctx, res
+}
+
+// error 将响应中的错误码转换为 *cosrpc.Error，服务端通过 Context.Error 返回 *cosrpc.Error 时从响应 metadata 还原错误详情
+func (xc *clients) error(res map[string]string, msg *values.Message) *cosrpc.Error {
+	if _, ok := res[cosrpc.MetaDataError]; ok {
+		return cosrpc.ParseError(res, msg.Error())
+	}
+	return cosrpc.AsError(msg)
+}
+
+// decompress 按响应 metadata 中的 MetaDataCompress 解压响应体
+func (xc *clients) decompress(res map[string]string, data []byte) ([]byte, error) {
+	if name := res[cosrpc.MetaDataCompress]; name != "" && len(data) > 0 {
+		return cosrpc.Decompress(name, data)
+	}
+	return data, nil
+}
+
 func (xc *clients) Binder(ctx context.Context, cts ...string) (r binder.Binder) {
 	return cosrpc.GetBinderFromContext(ctx, cts...)
 }
@@ -218,7 +397,7 @@ func (xc *clients) Async(ctx context.Context, servicePath, serviceMethod string,
 	}()
 	c := xc.Get(servicePath)
 	if c == nil {
-		return nil, fmt.Errorf("can not found any client:%v", servicePath)
+		return nil, cosrpc.NewError(cosrpc.ErrCodeServiceNotFound, "can not found any client:"+servicePath)
 	}
 	if ctx == nil {
 		var cancel context.CancelFunc
@@ -234,6 +413,11 @@ func (xc *clients) Async(ctx context.Context, servicePath, serviceMethod string,
 	if err != nil {
 		return nil, err
 	}
+	// 异步调用不等待结果，span 只记录发送
+	ctx, span := trace(ctx, servicePath, serviceMethod)
+	defer func() {
+		span.Finish(err)
+	}()
 	serviceMethod = registry.Join(serviceMethod)
 	return c.Go(ctx, serviceMethod, data, nil, nil)
 }
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/hwcer/cosrpc"
+	"github.com/smallnest/rpcx/share"
+)
+
+// observe 记录客户端调用指标，超过阈值时记录慢调用日志
+// 慢调用日志的对端地址取自 rpcx 写入响应 metadata 的 share.ServerAddress，in-process 调用为空
+func observe(ctx context.Context, servicePath, serviceMethod string, start time.Time, err error, req, res int) {
+	m := &cosrpc.Metric{
+		Side:          cosrpc.MetricSideClient,
+		ServicePath:   servicePath,
+		ServiceMethod: serviceMethod,
+		Latency:       time.Since(start),
+		RequestSize:   req,
+		ResponseSize:  res,
+	}
+	if err != nil {
+		m.Code = cosrpc.AsError(err).Code
+	}
+	cosrpc.Observe(m)
+	meta, _ := ctx.Value(share.ReqMetaDataKey).(map[string]string)
+	resMeta, _ := ctx.Value(share.ResMetaDataKey).(map[string]string)
+	cosrpc.Slowlog(m, meta, resMeta[share.ServerAddress])
+}
+
+// payloadSize 原始数据的长度，非 []byte 时返回 0
+func payloadSize(i any) int {
+	switch v := i.(type) {
+	case []byte:
+		return len(v)
+	case *[]byte:
+		return len(*v)
+	}
+	return 0
+}
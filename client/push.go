@@ -0,0 +1,97 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hwcer/cosgo/binder"
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/logger"
+	"github.com/smallnest/rpcx/protocol"
+)
+
+// Message 服务器推送的消息
+type Message = protocol.Message
+
+// PushHandler 处理服务器推送的消息
+type PushHandler func(msg *Message)
+
+// subscriber 双向通信消息分发
+// 存在订阅时客户端以双向模式创建，推送消息写入容量为 cosrpc.Config.ClientMessageChan 的通道
+// 由 cosrpc.Config.ClientMessageWorker 个协程分发给订阅者
+type subscriber struct {
+	once     sync.Once
+	mutex    sync.RWMutex
+	messages chan *Message
+	handlers map[string]PushHandler
+}
+
+func (s *subscriber) key(servicePath, serviceMethod string) string {
+	return servicePath + "." + serviceMethod
+}
+
+// Subscribe 订阅服务器推送
+// servicePath 和 serviceMethod 与服务端 Server.Push 的参数一致，都为空时接收所有未被订阅的消息
+// 必须在客户端创建(cosgo 加载配置)之前订阅，之后创建的客户端才会以双向模式连接
+func (s *subscriber) Subscribe(servicePath, serviceMethod string, handler PushHandler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.handlers == nil {
+		s.handlers = make(map[string]PushHandler)
+	}
+	s.handlers[s.key(servicePath, serviceMethod)] = handler
+}
+
+// channel 返回推送消息通道，没有订阅时返回 nil
+func (s *subscriber) channel() chan *Message {
+	s.mutex.RLock()
+	n := len(s.handlers)
+	s.mutex.RUnlock()
+	if n == 0 {
+		return nil
+	}
+	s.once.Do(func() {
+		s.messages = make(chan *Message, cosrpc.Config.ClientMessageChan)
+		worker := cosrpc.Config.ClientMessageWorker
+		if worker <= 0 {
+			worker = 1
+		}
+		for i := 0; i < worker; i++ {
+			go s.worker()
+		}
+	})
+	return s.messages
+}
+
+func (s *subscriber) worker() {
+	for msg := range s.messages {
+		s.dispatch(msg)
+	}
+}
+
+func (s *subscriber) dispatch(msg *Message) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("push message handler recover error:%v", r)
+		}
+	}()
+	s.mutex.RLock()
+	handler, ok := s.handlers[s.key(msg.ServicePath, msg.ServiceMethod)]
+	if !ok {
+		handler = s.handlers[s.key("", "")]
+	}
+	s.mutex.RUnlock()
+	if handler == nil {
+		logger.Debug("push message not subscribed:%v.%v", msg.ServicePath, msg.ServiceMethod)
+		return
+	}
+	handler(msg)
+}
+
+// Unmarshal 按推送消息 metadata 中的 Content-Type 反序列化
+func Unmarshal(msg *Message, i any) error {
+	if msg == nil {
+		return fmt.Errorf("push message is nil")
+	}
+	return binder.GetBinder(msg.Metadata, binder.HeaderContentType).Unmarshal(msg.Payload, i)
+}
@@ -0,0 +1,27 @@
+package client
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hwcer/cosrpc"
+	"github.com/smallnest/rpcx/share"
+)
+
+// trace 创建客户端 span 并将 traceparent 写入请求 metadata
+// 父节点依次取自 ctx 中的 span(服务端处理器使用 c.Context() 发起的下游调用)和请求 metadata 中已有的 traceparent，
+// 都没有时开始新的 trace
+func trace(ctx context.Context, servicePath, serviceMethod string) (context.Context, *cosrpc.Span) {
+	req, _ := ctx.Value(share.ReqMetaDataKey).(map[string]string)
+	parent := cosrpc.SpanFromContext(ctx)
+	if parent == nil {
+		parent = cosrpc.ParseTraceparent(req[cosrpc.MetaDataTraceparent])
+	}
+	span := cosrpc.NewSpan(parent, cosrpc.SpanKindClient, servicePath+"/"+strings.Trim(serviceMethod, "/"))
+	meta := make(map[string]string, len(req)+1)
+	for k, v := range req {
+		meta[k] = v
+	}
+	meta[cosrpc.MetaDataTraceparent] = span.Traceparent()
+	return context.WithValue(ctx, share.ReqMetaDataKey, meta), span
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// analyzer 从处理器函数体推断请求和响应类型
+type analyzer struct {
+	ctx  string //*cosrpc.Context 参数名
+	body *ast.BlockStmt
+}
+
+// args c.Bind 参数的类型
+func (a *analyzer) args() (t ast.Expr) {
+	a.inspect(func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || t != nil || len(call.Args) != 1 || !a.isContextCall(call, "Bind") {
+			return t == nil
+		}
+		switch v := call.Args[0].(type) {
+		case *ast.UnaryExpr:
+			if v.Op != token.AND {
+				break
+			}
+			if id, ok := v.X.(*ast.Ident); ok {
+				t = a.declType(id.Name)
+				if _, ok = t.(*ast.StarExpr); t != nil && !ok && !reference(t) {
+					t = &ast.StarExpr{X: t}
+				}
+			} else if lit, ok := v.X.(*ast.CompositeLit); ok {
+				t = &ast.StarExpr{X: lit.Type}
+			}
+		case *ast.Ident:
+			t = a.declType(v.Name)
+		}
+		return t == nil
+	})
+	return
+}
+
+// replies 每个 return 语句返回值的类型，无法推断时为 nil，忽略 nil 和 c.Error 等错误响应
+func (a *analyzer) replies() (r []ast.Expr) {
+	a.inspect(func(n ast.Node) bool {
+		ret, ok := n.(*ast.ReturnStmt)
+		if !ok {
+			return true
+		}
+		if len(ret.Results) != 1 {
+			r = append(r, nil)
+			return true
+		}
+		switch v := ret.Results[0].(type) {
+		case *ast.Ident:
+			if v.Name != "nil" {
+				r = append(r, a.declType(v.Name))
+			}
+		case *ast.CallExpr:
+			if !a.isContextCall(v, "Error", "Errorf") && !isErrorCall(v) {
+				r = append(r, nil)
+			}
+		default:
+			r = append(r, literalType(v))
+		}
+		return true
+	})
+	return
+}
+
+// inspect 遍历函数体，不进入嵌套的匿名函数
+func (a *analyzer) inspect(f func(ast.Node) bool) {
+	ast.Inspect(a.body, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false
+		}
+		return f(n)
+	})
+}
+
+func (a *analyzer) isContextCall(call *ast.CallExpr, names ...string) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	if id, ok := sel.X.(*ast.Ident); !ok || id.Name != a.ctx {
+		return false
+	}
+	for _, name := range names {
+		if sel.Sel.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// declType 函数体中变量声明的类型
+func (a *analyzer) declType(name string) (t ast.Expr) {
+	a.inspect(func(n ast.Node) bool {
+		switch v := n.(type) {
+		case *ast.ValueSpec:
+			for i, id := range v.Names {
+				if id.Name != name {
+					continue
+				}
+				if v.Type != nil {
+					t = v.Type
+				} else if i < len(v.Values) {
+					t = literalType(v.Values[i])
+				}
+			}
+		case *ast.AssignStmt:
+			if v.Tok != token.DEFINE || len(v.Lhs) != len(v.Rhs) {
+				break
+			}
+			for i, lhs := range v.Lhs {
+				if id, ok := lhs.(*ast.Ident); ok && id.Name == name {
+					t = literalType(v.Rhs[i])
+				}
+			}
+		}
+		return t == nil
+	})
+	return
+}
+
+// literalType &T{}、T{} 和 new(T) 的类型
+func literalType(e ast.Expr) ast.Expr {
+	switch v := e.(type) {
+	case *ast.UnaryExpr:
+		if lit, ok := v.X.(*ast.CompositeLit); ok && v.Op == token.AND && lit.Type != nil {
+			return &ast.StarExpr{X: lit.Type}
+		}
+	case *ast.CompositeLit:
+		return v.Type
+	case *ast.CallExpr:
+		if id, ok := v.Fun.(*ast.Ident); ok && id.Name == "new" && len(v.Args) == 1 {
+			return &ast.StarExpr{X: v.Args[0]}
+		}
+	}
+	return nil
+}
+
+// isErrorCall values.Error、values.Errorf 等错误响应
+func isErrorCall(call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	switch sel.Sel.Name {
+	case "Error", "Errorf", "NewError", "New":
+		return true
+	}
+	return false
+}
+
+// reference map 和切片直接作为请求参数，不再取地址
+func reference(t ast.Expr) bool {
+	switch t.(type) {
+	case *ast.MapType, *ast.ArrayType:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+// cosrpc-gen 扫描 Go 包中通过 server.Service / Registry 注册的服务，生成强类型的客户端调用代码
+//
+//	cosrpc-gen -o ./stub/user.go -pkg stub ./user ./order
+//
+// 支持的注册方式:
+//
+//	svc := server.Default.Service("user")
+//	svc.Register(&UserHandler{})                      // 结构体方法 func(c *cosrpc.Context) any
+//	svc.Register(&UserHandler{}, "account")           // 指定前缀
+//	server.Handle(svc, "/login", func(c *cosrpc.Context, req *LoginArgs) (*LoginReply, error) {...})
+//
+// 方法路径为 /前缀/方法名，未指定前缀时使用结构体类型名(/UserHandler/Login)，server.Handle 使用注册时的路径，
+// 生成代码保留原始大小写，调用时由 client 使用 registry.Join 按注册表的规则格式化
+//
+// 结构体方法的请求类型取自 c.Bind 的参数，响应类型取自 return 语句，无法推断时使用 any，
+// 也可以在方法注释中声明:
+//
+//	//cosrpc:args LoginArgs
+//	//cosrpc:reply *LoginReply
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	output := flag.String("o", "cosrpc_stub.go", "output file")
+	pkgName := flag.String("pkg", "", "package name of the output file, default is the scanned package when writing into it, otherwise the name of the output directory")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: cosrpc-gen [-o file] [-pkg name] dir...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(*output, *pkgName, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "cosrpc-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(output, pkgName string, dirs []string) error {
+	out, err := filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+	g := newGenerator(pkgName, filepath.Dir(out))
+	for _, dir := range dirs {
+		if err = g.scan(dir); err != nil {
+			return err
+		}
+	}
+	if len(g.services) == 0 {
+		return fmt.Errorf("no service found in %v", dirs)
+	}
+	buf := &bytes.Buffer{}
+	g.render(buf)
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("format output: %v\n%s", err, buf.Bytes())
+	}
+	return os.WriteFile(out, src, 0644)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestGenerate(t *testing.T) {
+	for _, name := range []string{"register", "prefix", "handle", "directive"} {
+		t.Run(name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "stub", "stub.go")
+			if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := run(output, "", []string{filepath.Join("testdata", name)}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", name+".golden")
+			if *update {
+				if err = os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("output mismatch %v, run go test -update to review\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestGenerateNoService(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(filepath.Join(dir, "stub.go"), "", []string{dir}); err == nil {
+		t.Fatal("want error when no service found")
+	}
+}
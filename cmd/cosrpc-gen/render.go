@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func (g *generator) render(w io.Writer) {
+	pkgName := g.pkgName
+	if pkgName == "" {
+		pkgName = filepath.Base(g.outDir)
+	}
+	fmt.Fprintf(w, "// Code generated by cosrpc-gen. DO NOT EDIT.\n\npackage %s\n\n", pkgName)
+
+	aliases := make([]string, 0, len(g.imports))
+	for alias := range g.imports {
+		aliases = append(aliases, alias)
+	}
+	// 标准库在前，其他包在后，分组之间空行
+	sort.Slice(aliases, func(i, j int) bool {
+		a, b := g.imports[aliases[i]], g.imports[aliases[j]]
+		if stdlib(a) != stdlib(b) {
+			return stdlib(a)
+		}
+		return a < b
+	})
+	fmt.Fprintln(w, "import (")
+	for i, alias := range aliases {
+		p := g.imports[alias]
+		if i > 0 && stdlib(g.imports[aliases[i-1]]) && !stdlib(p) {
+			fmt.Fprintln(w)
+		}
+		if alias == filepath.Base(p) {
+			fmt.Fprintf(w, "\t%q\n", p)
+		} else {
+			fmt.Fprintf(w, "\t%s %q\n", alias, p)
+		}
+	}
+	fmt.Fprintln(w, ")")
+
+	services := append([]*service(nil), g.services...)
+	sort.Slice(services, func(i, j int) bool { return services[i].name < services[j].name })
+	for _, s := range services {
+		s.render(w)
+	}
+}
+
+func (s *service) render(w io.Writer) {
+	name := camel(s.name) + "Service"
+	fmt.Fprintf(w, "\n// %s 服务 %s 的客户端\ntype %s struct {\n\tServicePath string\n}\n", name, s.name, name)
+	fmt.Fprintf(w, "\n// New%s 创建服务 %s 的客户端\nfunc New%s() *%s {\n\treturn &%s{ServicePath: %q}\n}\n", name, s.name, name, name, name, s.name)
+	for _, m := range s.methods {
+		m.render(w, name)
+	}
+}
+
+func (m *method) render(w io.Writer, recv string) {
+	args := m.args
+	if args == "" {
+		args = "any"
+	}
+	path := strconv.Quote(m.path)
+	fmt.Fprintf(w, "\n// %s 调用 %s\n", m.name, m.path)
+	if m.reply == "" {
+		fmt.Fprintf(w, "func (s *%s) %s(ctx context.Context, args %s, reply any) error {\n", recv, m.name, args)
+		fmt.Fprintf(w, "\treturn client.Manage.XCall(ctx, s.ServicePath, %s, args, reply)\n}\n", path)
+		return
+	}
+	fmt.Fprintf(w, "func (s *%s) %s(ctx context.Context, args %s) (%s, error) {\n", recv, m.name, args, m.reply)
+	if elem, ok := strings.CutPrefix(m.reply, "*"); ok {
+		fmt.Fprintf(w, "\treply := new(%s)\n", elem)
+		fmt.Fprintf(w, "\tif err := client.Manage.XCall(ctx, s.ServicePath, %s, args, reply); err != nil {\n\t\treturn nil, err\n\t}\n", path)
+	} else {
+		fmt.Fprintf(w, "\tvar reply %s\n", m.reply)
+		fmt.Fprintf(w, "\tif err := client.Manage.XCall(ctx, s.ServicePath, %s, args, &reply); err != nil {\n\t\treturn reply, err\n\t}\n", path)
+	}
+	fmt.Fprintf(w, "\treturn reply, nil\n}\n")
+}
+
+// stdlib 标准库的导入路径，第一段不包含 .
+func stdlib(importPath string) bool {
+	first, _, _ := strings.Cut(importPath, "/")
+	return !strings.Contains(first, ".")
+}
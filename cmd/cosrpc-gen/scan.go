@@ -0,0 +1,574 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// generator 收集服务并生成客户端代码
+type generator struct {
+	pkgName  string
+	outDir   string
+	imports  map[string]string //alias => import path
+	services []*service
+	index    map[string]*service
+}
+
+type service struct {
+	name    string
+	methods []*method
+	names   map[string]bool
+}
+
+type method struct {
+	name  string //生成的 Go 方法名
+	path  string //服务方法路径
+	args  string //请求类型，为空时使用 any
+	reply string //响应类型，为空时由调用方传入 reply
+}
+
+// scope 一个被扫描的包
+type scope struct {
+	g       *generator
+	name    string
+	path    string //包的导入路径，写入同一个包时为空
+	methods map[string][]*funcDecl
+	funcs   map[string]*funcDecl
+	vars    map[string]string //变量名 => 服务名
+}
+
+type funcDecl struct {
+	decl *ast.FuncDecl
+	file *ast.File
+}
+
+func newGenerator(pkgName, outDir string) *generator {
+	return &generator{
+		pkgName: pkgName,
+		outDir:  outDir,
+		imports: map[string]string{"context": "context", "client": "github.com/hwcer/cosrpc/client"},
+		index:   map[string]*service{},
+	}
+}
+
+// scan 扫描目录中的包
+func (g *generator) scan(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(pkgs))
+	for name := range pkgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err = g.scanPackage(dir, pkgs[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *generator) scanPackage(dir string, pkg *ast.Package) error {
+	s := &scope{
+		g:       g,
+		name:    pkg.Name,
+		methods: map[string][]*funcDecl{},
+		funcs:   map[string]*funcDecl{},
+		vars:    map[string]string{},
+	}
+	if dir == g.outDir {
+		if g.pkgName == "" {
+			g.pkgName = pkg.Name
+		}
+	} else {
+		if pkg.Name == "main" {
+			return fmt.Errorf("%v: package main can not be imported", dir)
+		}
+		importPath, err := modulePath(dir)
+		if err != nil {
+			return err
+		}
+		s.path = importPath
+	}
+	files := make([]string, 0, len(pkg.Files))
+	for name := range pkg.Files {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	for _, name := range files {
+		file := pkg.Files[name]
+		for _, d := range file.Decls {
+			fd, ok := d.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			if fd.Recv == nil {
+				s.funcs[fd.Name.Name] = &funcDecl{decl: fd, file: file}
+			} else if recv := receiver(fd); recv != "" {
+				s.methods[recv] = append(s.methods[recv], &funcDecl{decl: fd, file: file})
+			}
+		}
+	}
+	// 先收集保存服务的变量，再处理注册语句
+	for _, name := range files {
+		ast.Inspect(pkg.Files[name], s.collectVars)
+	}
+	for _, name := range files {
+		file := pkg.Files[name]
+		ast.Inspect(file, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpr); ok {
+				s.register(call, file)
+			}
+			return true
+		})
+	}
+	return nil
+}
+
+// alias 为导入路径分配不冲突的包名
+func (g *generator) alias(name, importPath string) string {
+	for k, v := range g.imports {
+		if v == importPath {
+			return k
+		}
+	}
+	alias := name
+	for i := 2; g.imports[alias] != ""; i++ {
+		alias = name + strconv.Itoa(i)
+	}
+	g.imports[alias] = importPath
+	return alias
+}
+
+func (g *generator) service(name string) *service {
+	if s, ok := g.index[name]; ok {
+		return s
+	}
+	s := &service{name: name, names: map[string]bool{}}
+	g.index[name] = s
+	g.services = append(g.services, s)
+	return s
+}
+
+func (s *service) add(m *method, prefix string) {
+	if s.names[m.name] {
+		m.name = camel(prefix) + m.name
+	}
+	for i := 2; s.names[m.name]; i++ {
+		m.name = m.name + strconv.Itoa(i)
+	}
+	s.names[m.name] = true
+	s.methods = append(s.methods, m)
+}
+
+func (s *scope) collectVars(n ast.Node) bool {
+	switch v := n.(type) {
+	case *ast.AssignStmt:
+		for i, rhs := range v.Rhs {
+			if name := serviceName(rhs); name != "" && i < len(v.Lhs) {
+				if id, ok := v.Lhs[i].(*ast.Ident); ok {
+					s.vars[id.Name] = name
+				}
+			}
+		}
+	case *ast.ValueSpec:
+		for i, rhs := range v.Values {
+			if name := serviceName(rhs); name != "" && i < len(v.Names) {
+				s.vars[v.Names[i].Name] = name
+			}
+		}
+	}
+	return true
+}
+
+// serviceOf 表达式对应的服务名
+func (s *scope) serviceOf(e ast.Expr) string {
+	if name := serviceName(e); name != "" {
+		return name
+	}
+	if id, ok := e.(*ast.Ident); ok {
+		return s.vars[id.Name]
+	}
+	return ""
+}
+
+func (s *scope) register(call *ast.CallExpr, file *ast.File) {
+	switch selectorName(call.Fun) {
+	case "Register":
+		sel := call.Fun.(*ast.SelectorExpr)
+		svc := s.serviceOf(sel.X)
+		if svc == "" || len(call.Args) == 0 {
+			return
+		}
+		prefix := ""
+		if len(call.Args) > 1 {
+			prefix = stringLit(call.Args[1])
+		}
+		if typ := structName(call.Args[0]); typ != "" {
+			if prefix == "" {
+				prefix = typ
+			}
+			for _, fd := range s.methods[typ] {
+				if m := s.handlerMethod(fd, prefix); m != nil {
+					s.g.service(svc).add(m, typ)
+				}
+			}
+		} else if fd := s.funcLit(call.Args[0], file); fd != nil && prefix != "" {
+			if m := s.handlerFunc(fd.typ, fd.body, fd.doc, fd.file, route(prefix)); m != nil {
+				s.g.service(svc).add(m, "")
+			}
+		}
+	case "Handle":
+		if len(call.Args) != 3 {
+			return
+		}
+		svc := s.serviceOf(call.Args[0])
+		p := stringLit(call.Args[1])
+		fd := s.funcLit(call.Args[2], file)
+		if svc == "" || p == "" || fd == nil {
+			return
+		}
+		params, results := fieldTypes(fd.typ.Params), fieldTypes(fd.typ.Results)
+		if len(params) != 2 || len(results) != 2 {
+			return
+		}
+		m := &method{name: camel(p), path: route(p)}
+		m.args = s.typeString(params[1], fd.file)
+		m.reply = s.typeString(results[0], fd.file)
+		s.g.service(svc).add(m, "")
+	}
+}
+
+type funcLit struct {
+	typ  *ast.FuncType
+	body *ast.BlockStmt
+	doc  *ast.CommentGroup
+	file *ast.File
+}
+
+// funcLit 匿名函数或者包内的函数
+func (s *scope) funcLit(e ast.Expr, file *ast.File) *funcLit {
+	switch v := e.(type) {
+	case *ast.FuncLit:
+		return &funcLit{typ: v.Type, body: v.Body, file: file}
+	case *ast.Ident:
+		if fd, ok := s.funcs[v.Name]; ok {
+			return &funcLit{typ: fd.decl.Type, body: fd.decl.Body, doc: fd.decl.Doc, file: fd.file}
+		}
+	}
+	return nil
+}
+
+// handlerMethod 结构体方法 func(c *cosrpc.Context) any
+func (s *scope) handlerMethod(fd *funcDecl, prefix string) *method {
+	if !fd.decl.Name.IsExported() {
+		return nil
+	}
+	m := s.handlerFunc(fd.decl.Type, fd.decl.Body, fd.decl.Doc, fd.file, route(prefix, fd.decl.Name.Name))
+	if m != nil {
+		m.name = fd.decl.Name.Name
+	}
+	return m
+}
+
+// handlerFunc 分析 func(c *cosrpc.Context) any 的请求和响应类型
+func (s *scope) handlerFunc(typ *ast.FuncType, body *ast.BlockStmt, doc *ast.CommentGroup, file *ast.File, p string) *method {
+	if typ.Params == nil || len(typ.Params.List) != 1 || len(typ.Params.List[0].Names) > 1 || len(fieldTypes(typ.Results)) != 1 {
+		return nil
+	}
+	param := typ.Params.List[0]
+	if star, ok := param.Type.(*ast.StarExpr); !ok || selectorName(star.X) != "Context" {
+		return nil
+	}
+	m := &method{name: camel(p), path: p}
+	if body != nil && len(param.Names) == 1 {
+		a := &analyzer{ctx: param.Names[0].Name, body: body}
+		if t := a.args(); t != nil {
+			m.args = s.typeString(t, file)
+		}
+		m.reply = s.reply(a, file)
+	}
+	if doc != nil {
+		for _, c := range doc.List {
+			text := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+			if v, ok := strings.CutPrefix(text, "cosrpc:args "); ok {
+				m.args = s.directive(v, file)
+			} else if v, ok = strings.CutPrefix(text, "cosrpc:reply "); ok {
+				m.reply = s.directive(v, file)
+			}
+		}
+	}
+	return m
+}
+
+// reply 所有 return 语句推断出的类型一致时作为响应类型
+func (s *scope) reply(a *analyzer, file *ast.File) string {
+	var reply string
+	for _, t := range a.replies() {
+		if t == nil {
+			return ""
+		}
+		r := s.typeString(t, file)
+		if reply != "" && r != reply {
+			return ""
+		}
+		reply = r
+	}
+	return reply
+}
+
+func (s *scope) directive(v string, file *ast.File) string {
+	e, err := parser.ParseExpr(strings.TrimSpace(v))
+	if err != nil {
+		return ""
+	}
+	return s.typeString(e, file)
+}
+
+// typeString 输出类型表达式，包内类型加上包名，其他包的类型添加导入
+func (s *scope) typeString(e ast.Expr, file *ast.File) string {
+	switch v := e.(type) {
+	case *ast.Ident:
+		if builtin[v.Name] || s.path == "" {
+			return v.Name
+		}
+		if !ast.IsExported(v.Name) {
+			return ""
+		}
+		return s.g.alias(s.name, s.path) + "." + v.Name
+	case *ast.StarExpr:
+		return wrap("*", s.typeString(v.X, file))
+	case *ast.ArrayType:
+		if v.Len != nil {
+			return ""
+		}
+		return wrap("[]", s.typeString(v.Elt, file))
+	case *ast.MapType:
+		k, val := s.typeString(v.Key, file), s.typeString(v.Value, file)
+		if k == "" || val == "" {
+			return ""
+		}
+		return "map[" + k + "]" + val
+	case *ast.InterfaceType:
+		if v.Methods == nil || len(v.Methods.List) == 0 {
+			return "any"
+		}
+	case *ast.SelectorExpr:
+		x, ok := v.X.(*ast.Ident)
+		if !ok {
+			return ""
+		}
+		if p := importOf(file, x.Name); p != "" {
+			return s.g.alias(x.Name, p) + "." + v.Sel.Name
+		}
+	}
+	return ""
+}
+
+func wrap(prefix, s string) string {
+	if s == "" {
+		return ""
+	}
+	return prefix + s
+}
+
+var builtin = map[string]bool{
+	"any": true, "bool": true, "byte": true, "complex64": true, "complex128": true, "error": true,
+	"float32": true, "float64": true, "int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"rune": true, "string": true, "uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+}
+
+// importOf 文件中包名对应的导入路径
+func importOf(file *ast.File, name string) string {
+	for _, spec := range file.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		if spec.Name != nil {
+			if spec.Name.Name == name {
+				return p
+			}
+			continue
+		}
+		base := path.Base(p)
+		if strings.HasPrefix(base, "v") && len(strings.Split(p, "/")) > 1 {
+			if _, err = strconv.Atoi(base[1:]); err == nil {
+				base = path.Base(path.Dir(p))
+			}
+		}
+		if base == name {
+			return p
+		}
+	}
+	return ""
+}
+
+// modulePath 根据 go.mod 计算目录的导入路径
+func modulePath(dir string) (string, error) {
+	for root := dir; ; {
+		f, err := os.Open(filepath.Join(root, "go.mod"))
+		if err == nil {
+			module := ""
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				if fields := strings.Fields(scanner.Text()); len(fields) >= 2 && fields[0] == "module" {
+					module = strings.Trim(fields[1], `"`)
+					break
+				}
+			}
+			_ = f.Close()
+			if module == "" {
+				return "", fmt.Errorf("%v: module path not found", filepath.Join(root, "go.mod"))
+			}
+			rel, err := filepath.Rel(root, dir)
+			if err != nil {
+				return "", err
+			}
+			return path.Join(module, filepath.ToSlash(rel)), nil
+		}
+		parent := filepath.Dir(root)
+		if parent == root {
+			return "", fmt.Errorf("%v: go.mod not found", dir)
+		}
+		root = parent
+	}
+}
+
+// serviceName Service("name") 调用中的服务名
+func serviceName(e ast.Expr) string {
+	call, ok := e.(*ast.CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return ""
+	}
+	if name := selectorName(call.Fun); name != "Service" {
+		return ""
+	}
+	return stringLit(call.Args[0])
+}
+
+// selectorName 函数名，支持 a.B、B 和泛型实例化 a.B[T]
+func selectorName(e ast.Expr) string {
+	switch v := e.(type) {
+	case *ast.SelectorExpr:
+		return v.Sel.Name
+	case *ast.Ident:
+		return v.Name
+	case *ast.IndexExpr:
+		return selectorName(v.X)
+	case *ast.IndexListExpr:
+		return selectorName(v.X)
+	}
+	return ""
+}
+
+func stringLit(e ast.Expr) string {
+	lit, ok := e.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return ""
+	}
+	s, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return ""
+	}
+	return s
+}
+
+// structName &T{}、T{} 和 new(T) 中的类型名
+func structName(e ast.Expr) string {
+	switch v := e.(type) {
+	case *ast.UnaryExpr:
+		if v.Op == token.AND {
+			return structName(v.X)
+		}
+	case *ast.CompositeLit:
+		if id, ok := v.Type.(*ast.Ident); ok {
+			return id.Name
+		}
+	case *ast.CallExpr:
+		if id, ok := v.Fun.(*ast.Ident); ok && id.Name == "new" && len(v.Args) == 1 {
+			if t, ok := v.Args[0].(*ast.Ident); ok {
+				return t.Name
+			}
+		}
+	}
+	return ""
+}
+
+func receiver(fd *ast.FuncDecl) string {
+	if len(fd.Recv.List) == 0 {
+		return ""
+	}
+	t := fd.Recv.List[0].Type
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	if id, ok := t.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// fieldTypes 展开参数列表中的类型，a, b int 展开为两个
+func fieldTypes(fl *ast.FieldList) (r []ast.Expr) {
+	if fl == nil {
+		return
+	}
+	for _, f := range fl.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			r = append(r, f.Type)
+		}
+	}
+	return
+}
+
+// route 方法路径，以 / 开头，前缀和方法名使用 / 连接，不改变大小写
+// 结构体的默认前缀为类型名，与 Service.Register 传给注册表的一致；
+// 调用时 client 使用 registry.Join 格式化路径，与注册表格式化路由的规则相同
+func route(paths ...string) string {
+	return "/" + strings.Trim(path.Join(paths...), "/")
+}
+
+// camel 将路径转换为 Go 方法名，/user/get_info => UserGetInfo
+func camel(s string) string {
+	b := strings.Builder{}
+	upper := true
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z':
+			if upper {
+				r -= 'a' - 'A'
+			}
+			b.WriteRune(r)
+			upper = false
+		case r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' && b.Len() > 0:
+			b.WriteRune(r)
+			upper = false
+		default:
+			upper = true
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,40 @@
+package directive
+
+import (
+	"time"
+
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/cosrpc/server"
+)
+
+type BuyArgs struct {
+	ID int32 `json:"id"`
+}
+
+type BuyReply struct {
+	Expire time.Time `json:"expire"`
+}
+
+type ShopHandler struct{}
+
+// Buy 请求和响应类型由注释声明
+//
+//cosrpc:args *BuyArgs
+//cosrpc:reply *BuyReply
+func (h *ShopHandler) Buy(c *cosrpc.Context) any {
+	return h.buy(c)
+}
+
+//cosrpc:reply map[string]time.Time
+func (h *ShopHandler) Expire(c *cosrpc.Context) any {
+	return h.buy(c)
+}
+
+func (h *ShopHandler) buy(c *cosrpc.Context) any {
+	return nil
+}
+
+func init() {
+	shop := server.Default.Service("shop")
+	_ = shop.Register(&ShopHandler{})
+}
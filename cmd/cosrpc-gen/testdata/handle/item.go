@@ -0,0 +1,29 @@
+package handle
+
+import (
+	"context"
+
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/cosrpc/server"
+)
+
+type GetArgs struct {
+	ID int64 `json:"id"`
+}
+
+type Item struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func init() {
+	svc := server.Default.Service("item")
+	server.Handle(svc, "/get_info", func(c *cosrpc.Context, req *GetArgs) (*Item, error) {
+		return &Item{ID: req.ID}, nil
+	})
+	server.Handle[context.Context, []*Item](svc, "list", list)
+}
+
+func list(c *cosrpc.Context, req context.Context) ([]*Item, error) {
+	return nil, nil
+}
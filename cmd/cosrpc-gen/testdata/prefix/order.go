@@ -0,0 +1,31 @@
+package prefix
+
+import (
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/cosrpc/server"
+)
+
+type CreateArgs struct {
+	Items []int32 `json:"items"`
+}
+
+type OrderHandler struct{}
+
+func (h *OrderHandler) Create(c *cosrpc.Context) any {
+	var args CreateArgs
+	if err := c.Bind(&args); err != nil {
+		return c.Errorf(1, err)
+	}
+	return args.Items
+}
+
+var order = server.Default.Service("order")
+
+func init() {
+	_ = order.Register(&OrderHandler{}, "/v1/order")
+	_ = order.Register(ping, "/ping")
+}
+
+func ping(c *cosrpc.Context) any {
+	return "pong"
+}
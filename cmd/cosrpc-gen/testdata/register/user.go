@@ -0,0 +1,47 @@
+package register
+
+import (
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/cosrpc/server"
+)
+
+type LoginArgs struct {
+	Name string `json:"name"`
+}
+
+type LoginReply struct {
+	Token string `json:"token"`
+}
+
+type UserHandler struct{}
+
+func (h *UserHandler) Login(c *cosrpc.Context) any {
+	args := &LoginArgs{}
+	if err := c.Bind(args); err != nil {
+		return c.Error(err)
+	}
+	return &LoginReply{Token: args.Name}
+}
+
+func (h *UserHandler) Info(c *cosrpc.Context) any {
+	var id int64
+	if err := c.Bind(&id); err != nil {
+		return c.Error(err)
+	}
+	reply := map[string]any{"id": id}
+	return reply
+}
+
+// Logout 响应类型无法推断
+func (h *UserHandler) Logout(c *cosrpc.Context) any {
+	return h.logout(c)
+}
+
+func (h *UserHandler) logout(c *cosrpc.Context) any {
+	return nil
+}
+
+func init() {
+	svc := server.Default.Service("user")
+	_ = svc.Register(&UserHandler{})
+}
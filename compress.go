@@ -0,0 +1,101 @@
+package cosrpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/golang/snappy"
+	"github.com/smallnest/rpcx/protocol"
+)
+
+// 请求体和响应体压缩算法
+const (
+	CompressNone   = "none"
+	CompressGzip   = "gzip"
+	CompressSnappy = "snappy"
+)
+
+const (
+	MetaDataCompress       = "_rpc_compress" //请求体或响应体使用的压缩算法，由框架设置
+	MetaDataAcceptCompress = "_rpc_accept"   //调用方期望使用的压缩算法，可以在请求 metadata 中设置以覆盖服务配置
+)
+
+var compressors = map[string]protocol.Compressor{
+	CompressGzip:   &protocol.GzipCompressor{},
+	CompressSnappy: &protocol.SnappyCompressor{},
+}
+
+func compressor(name string) (protocol.Compressor, error) {
+	if c, ok := compressors[strings.ToLower(name)]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("compress type unknown:%v", name)
+}
+
+// Compress 使用指定算法压缩数据
+func Compress(name string, data []byte) ([]byte, error) {
+	c, err := compressor(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.Zip(data)
+}
+
+// Decompress 使用指定算法解压数据
+func Decompress(name string, data []byte) ([]byte, error) {
+	c, err := compressor(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.Unzip(data)
+}
+
+// DecompressLimit 解压数据，解压后的长度超过 limit 时返回 ErrPayloadTooLarge
+// 读到 limit 即停止，避免压缩炸弹耗尽内存，limit <= 0 时不限制
+func DecompressLimit(name string, data []byte, limit int) ([]byte, error) {
+	if limit <= 0 || len(data) == 0 {
+		return Decompress(name, data)
+	}
+	var r io.Reader
+	switch strings.ToLower(name) {
+	case CompressGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	case CompressSnappy:
+		r = snappy.NewReader(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("compress type unknown:%v", name)
+	}
+	out, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > limit {
+		return nil, ErrPayloadTooLarge
+	}
+	return out, nil
+}
+
+// Compression 服务使用的压缩算法，未配置或配置为 none 时返回空字符串
+func Compression(servicePath string) string {
+	name, ok := Config.Compresses[servicePath]
+	if !ok {
+		name = Config.Compress
+	}
+	if name = strings.ToLower(name); name == CompressNone {
+		return ""
+	}
+	return name
+}
+
+// Compressible 数据长度达到压缩阈值
+func Compressible(data []byte) bool {
+	return len(data) > 0 && len(data) >= Config.CompressThreshold
+}
@@ -2,9 +2,15 @@ package cosrpc
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"strconv"
+	"time"
 
 	"github.com/hwcer/cosgo/binder"
 	"github.com/hwcer/cosgo/values"
@@ -13,6 +19,16 @@ import (
 	"github.com/smallnest/rpcx/share"
 )
 
+// SessionContextKey 上下文中保存连接会话的键
+var SessionContextKey = &contextKey{name: "session"}
+
+// PrincipalContextKey 上下文中保存认证身份的键
+var PrincipalContextKey = &contextKey{name: "principal"}
+
+type contextKey struct {
+	name string
+}
+
 // IContext 定义上下文接口
 // 用于处理 RPC 请求和响应
 type IContext interface {
@@ -25,6 +41,11 @@ type IContext interface {
 	Write(reply any) error
 }
 
+// IContextContext 可以直接提供 context.Context 的上下文（如 inprocess 模式）
+type IContextContext interface {
+	Context() context.Context
+}
+
 // IContextBinder 支持自定义 Bind 的上下文（如 inprocess 模式）
 //type IContextBinder interface {
 //	Bind(v any) error
@@ -39,8 +60,14 @@ func NewContext(ctx IContext) *Context {
 // Context 是 cosrpc 上下文的核心结构
 // 封装了 IContext 接口并提供了便捷的方法
 type Context struct {
-	ctx  IContext      // 底层的上下文接口
-	body values.Values // 请求体的解析结果
+	ctx     IContext           // 底层的上下文接口
+	body    values.Values      // 请求体的解析结果
+	data    []byte             // 解压后的请求体
+	loaded  bool               // data 已经读取，解压失败时不再重试
+	dataErr error              // 解压请求体的错误
+	goctx   context.Context    // 携带调用方截止时间的 context.Context
+	cancel  context.CancelFunc // 释放 goctx
+	span    *Span              // 服务端 span
 }
 
 // Binder 获取绑定器
@@ -51,14 +78,60 @@ func (this *Context) Binder(cts ...string) (b binder.Binder) {
 	return binder.GetBinder(meta, cts...)
 }
 
-// Reader 返回一个 io.Reader 来读取包体
+// Reader 返回一个 io.Reader 来读取包体，解压失败时读取返回解压错误
 func (this *Context) Reader() io.Reader {
-	return bytes.NewReader(this.ctx.Payload())
+	data, err := this.payload()
+	if err != nil {
+		return &errReader{err: err}
+	}
+	return bytes.NewReader(data)
 }
 
-// Bytes 返回包体的字节数组
+// Bytes 返回包体的字节数组，解压失败时返回 nil，错误由 Bind 返回
 func (this *Context) Bytes() []byte {
-	return this.ctx.Payload()
+	data, _ := this.payload()
+	return data
+}
+
+// payload 返回包体，按 metadata 中的 MetaDataCompress 解压
+// 结果(包括解压错误)只计算一次
+func (this *Context) payload() ([]byte, error) {
+	if !this.loaded {
+		this.loaded = true
+		this.data = this.ctx.Payload()
+		if name := this.GetMetadata(MetaDataCompress); name != "" && len(this.data) > 0 {
+			this.data, this.dataErr = Decompress(name, this.data)
+		}
+	}
+	return this.data, this.dataErr
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// LimitPayload 检查请求体长度，压缩时检查解压后的长度，超过 limit 时返回 ErrPayloadTooLarge
+// 由服务器在 Bind 之前调用，limit <= 0 时不限制
+func (this *Context) LimitPayload(limit int) error {
+	if limit <= 0 || this.loaded {
+		return nil
+	}
+	raw := this.ctx.Payload()
+	if len(raw) > limit {
+		return ErrPayloadTooLarge
+	}
+	if name := this.GetMetadata(MetaDataCompress); name != "" && len(raw) > 0 {
+		data, err := DecompressLimit(name, raw, limit)
+		if err != nil {
+			return err
+		}
+		this.data, this.loaded = data, true
+	}
+	return nil
 }
 
 // Write 写入响应数据
@@ -67,16 +140,23 @@ func (this *Context) Write(data []byte) error {
 }
 
 // Bind 绑定请求数据到指定的结构体
+// 请求体解压失败时返回解压错误，不会绑定空数据
+// 设置了校验器时，绑定后执行校验规则，失败时返回错误码为 ErrCodeValidation 的错误，参见 SetValidator
 func (this *Context) Bind(i interface{}) error {
 	//if b, ok := this.ctx.(IContextBinder); ok {
 	//	return b.Bind(i)
 	//}
-	data := this.ctx.Payload()
-	if len(data) == 0 {
-		return nil
+	data, err := this.payload()
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		bind := this.Binder()
+		if err = bind.Unmarshal(data, i); err != nil {
+			return err
+		}
 	}
-	bind := this.Binder()
-	return bind.Unmarshal(data, i)
+	return Validate(i)
 }
 
 // Conn 获取网络连接，in-process 模式或值缺失时返回 nil
@@ -87,8 +167,119 @@ func (this *Context) Conn() net.Conn {
 	return nil
 }
 
+// PeerCertificate 获取客户端证书，未启用双向 TLS 时返回 nil
+func (this *Context) PeerCertificate() *x509.Certificate {
+	conn, ok := this.Conn().(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	if certs := conn.ConnectionState().PeerCertificates; len(certs) > 0 {
+		return certs[0]
+	}
+	return nil
+}
+
+// PeerSubject 获取客户端证书的 Subject，未启用双向 TLS 时返回空字符串
+func (this *Context) PeerSubject() string {
+	if cert := this.PeerCertificate(); cert != nil {
+		return cert.Subject.String()
+	}
+	return ""
+}
+
+// Principal 获取认证通过的调用方身份，参见 server.Authenticator
+func (this *Context) Principal() string {
+	v, _ := this.GetValue(PrincipalContextKey).(string)
+	return v
+}
+
+// Session 获取当前连接的会话，in-process 模式返回 nil
+func (this *Context) Session() *Session {
+	if v, ok := this.GetValue(SessionContextKey).(*Session); ok {
+		return v
+	}
+	return nil
+}
+
+// Context 返回携带调用方截止时间的 context.Context
+// 网络模式下截止时间来自客户端通过 metadata 传递的剩余时间(share.ServerTimeout)
+// in-process 模式使用调用方 ctx 的截止时间和取消信号，不继承其中的值(包括请求和响应 metadata)
+// 在处理器中发起的下游调用使用该 ctx 即可继承剩余的时间预算和 trace context
+func (this *Context) Context() context.Context {
+	if this.goctx == nil {
+		this.goctx, this.cancel = this.newContext()
+		this.goctx = ContextWithSpan(this.goctx, this.span)
+	}
+	return this.goctx
+}
+
+// StartSpan 从请求 metadata 提取 trace context 并创建服务端 span，由服务器在请求开始时调用
+// 调用方未携带 traceparent 时开始新的 trace
+func (this *Context) StartSpan() *Span {
+	parent := ParseTraceparent(this.GetMetadata(MetaDataTraceparent))
+	this.span = NewSpan(parent, SpanKindServer, this.ServicePath()+"/"+this.ServiceMethod())
+	return this.span
+}
+
+// Span 获取服务端 span，未调用 StartSpan 时返回 nil
+func (this *Context) Span() *Span {
+	return this.span
+}
+
+// TraceID 获取请求所在调用链的 trace id，可以作为请求 id 记录日志
+func (this *Context) TraceID() string {
+	if this.span != nil {
+		return this.span.TraceID
+	}
+	return ""
+}
+
+// Release 释放 Context() 创建的定时器，由服务器在请求结束时调用
+func (this *Context) Release() {
+	if this.cancel != nil {
+		this.cancel()
+		this.cancel = nil
+	}
+}
+
+func (this *Context) newContext() (context.Context, context.CancelFunc) {
+	if v, ok := this.ctx.(IContextContext); ok {
+		if ctx := v.Context(); ctx != nil {
+			return detachedContext{Context: ctx}, nil
+		}
+	}
+	// 未携带剩余时间时没有截止时间；剩余时间 <= 0 时调用方已经超时，返回已过期的 ctx
+	timeout, err := strconv.ParseInt(this.GetMetadata(share.ServerTimeout), 10, 64)
+	if err != nil {
+		return context.Background(), nil
+	}
+	start := time.Now()
+	if v, ok := this.GetValue(server.StartRequestContextKey).(int64); ok {
+		start = time.Unix(0, v)
+	}
+	return context.WithDeadline(context.Background(), start.Add(time.Duration(timeout)*time.Millisecond))
+}
+
+// detachedContext 只保留调用方 ctx 的截止时间和取消信号，不继承其中的值
+// 与网络模式一致，下游调用不会带上调用方的请求 metadata，响应 metadata 也不会写入调用方的 map
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Value(any) any {
+	return nil
+}
+
 // Error 创建一个错误消息
+// err 包含 *Error(如校验失败)时保留错误码，详情写入响应 metadata(MetaDataError)，client.XCall 据此还原 *Error
 func (this *Context) Error(err any) *values.Message {
+	var e *Error
+	if v, ok := err.(error); ok && errors.As(v, &e) {
+		if len(e.Details) > 0 {
+			this.SetMetadata(MetaDataError, e.Marshal())
+		}
+		return values.Errorf(e.Code, "%s", e.Message)
+	}
 	return values.Error(err)
 }
 
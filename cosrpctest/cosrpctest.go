@@ -0,0 +1,157 @@
+// Package cosrpctest 提供基于内存连接的测试服务器和客户端
+//
+//	func TestLogin(t *testing.T) {
+//		ts := cosrpctest.New(t)
+//		ts.Service("user").Register(&UserHandler{})
+//		if err := ts.Start(); err != nil {
+//			t.Fatal(err)
+//		}
+//		reply, err := cosrpctest.Invoke[LoginReply](context.Background(), ts, "user", "UserHandler/Login", &LoginArgs{})
+//		...
+//		calls := ts.Calls()
+//	}
+//
+// 每个 Server 使用独立的 server.Server、内存监听地址和 client.Manager，
+// 不占用端口，不依赖 cosgo 生命周期事件以及 server.Default、client.Manage，测试结束时自动关闭
+package cosrpctest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akutz/memconn"
+	"github.com/hwcer/cosgo/registry"
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/cosrpc/client"
+	"github.com/hwcer/cosrpc/server"
+)
+
+// Network 内存连接的网络类型
+const Network = "memu"
+
+var seq int64
+
+// Call 服务端收到的一次调用
+type Call struct {
+	ServicePath   string
+	ServiceMethod string
+	Metadata      map[string]string
+	Payload       []byte
+	Reply         any
+	Err           error
+	Duration      time.Duration
+}
+
+// Server 测试服务器
+type Server struct {
+	*server.Server
+	Address  string          // 客户端连接地址，memu@name
+	Client   *client.Manager // 连接到该服务器的客户端管理器
+	tb       testing.TB
+	listener net.Listener
+	calls    []*Call
+	mutex    sync.Mutex
+	closed   int32
+}
+
+// New 创建测试服务器，tb 结束时自动关闭
+// opts 中的 Network、Address、TLS 和 Register 不生效
+func New(tb testing.TB, opts ...server.Options) *Server {
+	tb.Helper()
+	s, err := NewServer(opts...)
+	if err != nil {
+		tb.Fatalf("cosrpctest: %v", err)
+	}
+	s.tb = tb
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// NewServer 创建测试服务器，使用完毕后需要调用 Close
+func NewServer(opts ...server.Options) (*Server, error) {
+	name := fmt.Sprintf("cosrpctest-%d", atomic.AddInt64(&seq, 1))
+	ln, err := memconn.Listen(Network, name)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Server:   server.New(opts...),
+		Address:  Network + "@" + name,
+		Client:   client.NewManager(),
+		listener: ln,
+	}
+	return s, nil
+}
+
+// Service 创建服务并记录其中的所有调用，同时为客户端添加该服务
+// 添加客户端失败时，由 New 创建的服务器调用 tb.Fatalf，由 NewServer 创建的服务器 panic
+func (s *Server) Service(name string, handlers ...any) *registry.Service {
+	handlers = append(handlers, server.HandlerInterceptor(s.record))
+	svc := s.Server.Service(name, handlers...)
+	if err := s.Client.Add(name, s.Address); err != nil {
+		if s.tb == nil {
+			panic(fmt.Sprintf("cosrpctest: add client %v: %v", name, err))
+		}
+		s.tb.Helper()
+		s.tb.Fatalf("cosrpctest: add client %v: %v", name, err)
+	}
+	return svc
+}
+
+// Start 启动服务器，在 Start 之后创建的服务需要调用 Publish 发布
+func (s *Server) Start() error {
+	return s.Server.Listen(s.listener)
+}
+
+// Close 关闭客户端和服务器
+func (s *Server) Close() {
+	if !atomic.CompareAndSwapInt32(&s.closed, 0, 1) {
+		return
+	}
+	_ = s.Client.Close()
+	_ = s.Server.Close()
+	_ = s.listener.Close()
+}
+
+// Calls 返回已经记录的调用
+func (s *Server) Calls() []*Call {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]*Call(nil), s.calls...)
+}
+
+// Reset 清空已经记录的调用
+func (s *Server) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.calls = nil
+}
+
+func (s *Server) record(c *cosrpc.Context, next func() (interface{}, error)) (interface{}, error) {
+	call := &Call{
+		ServicePath:   c.ServicePath(),
+		ServiceMethod: c.ServiceMethod(),
+		Metadata:      make(map[string]string),
+		Payload:       append([]byte(nil), c.Bytes()...),
+	}
+	for k, v := range c.Metadata() {
+		call.Metadata[k] = v
+	}
+	start := time.Now()
+	reply, err := next()
+	call.Reply, call.Err, call.Duration = reply, err, time.Since(start)
+	s.mutex.Lock()
+	s.calls = append(s.calls, call)
+	s.mutex.Unlock()
+	return reply, err
+}
+
+// Invoke 通过测试服务器的客户端发起强类型调用，参见 client.Invoke
+func Invoke[Resp any](ctx context.Context, s *Server, servicePath, serviceMethod string, req any) (*Resp, error) {
+	return client.InvokeWith[Resp](ctx, s.Client, servicePath, serviceMethod, req)
+}
@@ -0,0 +1,68 @@
+package cosrpctest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hwcer/cosrpc"
+)
+
+type echoArgs struct {
+	Name string `json:"name"`
+}
+
+type echoReply struct {
+	Hello string `json:"hello"`
+}
+
+func echo(c *cosrpc.Context) any {
+	args := &echoArgs{}
+	if err := c.Bind(args); err != nil {
+		return c.Error(err)
+	}
+	return &echoReply{Hello: args.Name}
+}
+
+func TestServer(t *testing.T) {
+	ts := New(t)
+	if err := ts.Service("echo").Register(echo, "/hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Start(); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := Invoke[echoReply](context.Background(), ts, "echo", "/hello", &echoArgs{Name: "cosrpc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Hello != "cosrpc" {
+		t.Errorf("reply = %+v", reply)
+	}
+	calls := ts.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("calls = %v, want 1", len(calls))
+	}
+	if c := calls[0]; c.ServicePath != "echo" || c.ServiceMethod != "/hello" || c.Err != nil {
+		t.Errorf("call = %+v", c)
+	}
+	ts.Reset()
+	if n := len(ts.Calls()); n != 0 {
+		t.Errorf("calls after Reset = %v", n)
+	}
+}
+
+func TestServerUnknownService(t *testing.T) {
+	ts := New(t)
+	if err := ts.Service("echo").Register(echo, "/hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Start(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Invoke[echoReply](context.Background(), ts, "unknown", "/hello", &echoArgs{})
+	var e *cosrpc.Error
+	if !errors.As(err, &e) || e.Code != cosrpc.ErrCodeServiceNotFound {
+		t.Fatalf("err = %v, want ErrCodeServiceNotFound", err)
+	}
+}
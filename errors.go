@@ -0,0 +1,107 @@
+package cosrpc
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/hwcer/cosgo/values"
+)
+
+// 框架内置错误码，通过 values.Message.Code 或 Error.Code 返回给调用方
+const (
+	ErrCodeUnauthorized    int32 = 401 //认证失败
+	ErrCodeServiceNotFound int32 = 404 //服务不存在或已经注销
+	ErrCodePayloadTooLarge int32 = 413 //请求体超过长度限制
+	ErrCodeValidation      int32 = 422 //请求参数校验失败
+	ErrCodeRateLimit       int32 = 429 //请求被限流
+	ErrCodeInternal        int32 = 500 //服务端内部错误，包括 panic 和未携带错误码的 error
+	ErrCodeServerClosing   int32 = 503 //服务器正在关闭
+	ErrCodeDeadline        int32 = 504 //排队等待时调用方已经超时或取消
+	ErrCodeServiceBusy     int32 = 509 //并发数达到上限
+)
+
+// MetaDataError 服务端返回错误时，在响应 metadata 中携带的结构化错误(JSON)
+const MetaDataError = "_rpc_error"
+
+// ErrPayloadTooLarge 请求体超过长度限制，参见 MaxPayload
+var ErrPayloadTooLarge = NewError(ErrCodePayloadTooLarge, "payload too large")
+
+// Error 统一的结构化错误
+// 无论错误来自 rpcx 网络调用、进程内调用还是 Broadcast，调用方都可以通过 errors.As 获取
+type Error struct {
+	Code    int32          `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+	cause   error          //AsError 转换前的原始错误，不会传递给调用方
+}
+
+// NewError 创建结构化错误
+func NewError(code int32, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap 返回 AsError 转换前的原始错误，errors.Is(err, context.DeadlineExceeded) 等判断可以穿透 *Error
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// IsServiceError 实现 rpcx client.ServiceError
+// 服务器关闭中返回 false，由 Failover 关闭到该节点的连接并换节点重试；其他错误返回 true，rpcx 不重试
+// rpcx 重试前会关闭连接并中断其上的其他请求，并发达到上限和限流由 cosrpc 客户端不关闭连接重新选择节点重试，参见 client.Manager.XCall
+func (e *Error) IsServiceError() bool {
+	return e.Code != ErrCodeServerClosing
+}
+
+// WithDetail 附加错误详情
+func (e *Error) WithDetail(key string, value any) *Error {
+	if e.Details == nil {
+		e.Details = map[string]any{}
+	}
+	e.Details[key] = value
+	return e
+}
+
+// Marshal 编码后写入 MetaDataError
+func (e *Error) Marshal() string {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// AsError 将任意错误转换为 *Error
+// *Error 原样返回，values.Message 保留错误码，其他错误使用 ErrCodeInternal，原始错误可以通过 errors.Unwrap 获取
+func AsError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	var msg *values.Message
+	if errors.As(err, &msg) {
+		code := msg.Code
+		if code == 0 {
+			code = ErrCodeInternal
+		}
+		return &Error{Code: code, Message: msg.Error(), cause: err}
+	}
+	return &Error{Code: ErrCodeInternal, Message: err.Error(), cause: err}
+}
+
+// ParseError 从响应 metadata 还原结构化错误，metadata 缺失或无法解析时使用 message 构造
+func ParseError(meta map[string]string, message string) *Error {
+	if s := meta[MetaDataError]; s != "" {
+		e := &Error{}
+		if err := json.Unmarshal([]byte(s), e); err == nil {
+			return e
+		}
+	}
+	return &Error{Code: ErrCodeInternal, Message: message}
+}
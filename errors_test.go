@@ -0,0 +1,109 @@
+package cosrpc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hwcer/cosgo/registry"
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/cosrpc/client"
+	"github.com/hwcer/cosrpc/cosrpctest"
+	"github.com/hwcer/cosrpc/server"
+)
+
+type loginArgs struct {
+	Name string `json:"name" validate:"required,min=2"`
+	Age  int    `json:"age" validate:"min=1,max=150"`
+}
+
+// registerErrors 注册返回各种错误的方法
+func registerErrors(t *testing.T, svc *registry.Service) {
+	t.Helper()
+	handlers := map[string]any{
+		"/detail": server.HandlerFunc(func(c *cosrpc.Context) (interface{}, error) {
+			return nil, cosrpc.NewError(1001, "gold not enough").WithDetail("need", 100)
+		}),
+		"/errorf": func(c *cosrpc.Context) any {
+			return c.Errorf(1002, "item %v not found", 7)
+		},
+		"/validate": func(c *cosrpc.Context) any {
+			args := &loginArgs{}
+			if err := c.Bind(args); err != nil {
+				return c.Error(err)
+			}
+			return args
+		},
+		"/plain": server.HandlerFunc(func(c *cosrpc.Context) (interface{}, error) {
+			return nil, errors.New("database down")
+		}),
+	}
+	for name, h := range handlers {
+		if err := svc.Register(h, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// 服务端返回的错误在网络和 in-process 模式下都可以通过 errors.As 获取 *cosrpc.Error，错误码和详情保持不变
+func TestErrorRoundTrip(t *testing.T) {
+	cosrpc.SetValidator(cosrpc.TagValidator{})
+	t.Cleanup(func() { cosrpc.SetValidator(nil) })
+
+	ts := cosrpctest.New(t)
+	registerErrors(t, ts.Service("errors"))
+	if err := ts.Start(); err != nil {
+		t.Fatal(err)
+	}
+	const local = "errors-inprocess"
+	registerErrors(t, server.Default.Service(local))
+	m := client.NewManager()
+	if err := m.Add(local, cosrpc.SelectorTypeProcess); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	modes := []struct {
+		name        string
+		m           *client.Manager
+		servicePath string
+	}{
+		{"network", ts.Client, "errors"},
+		{"inprocess", m, local},
+	}
+	tests := []struct {
+		method  string
+		req     any
+		code    int32
+		message string
+		details map[string]string
+	}{
+		{"/detail", nil, 1001, "gold not enough", map[string]string{"need": "100"}},
+		{"/errorf", nil, 1002, "item 7 not found", nil},
+		{"/validate", &loginArgs{Name: "cosrpc", Age: 200}, cosrpc.ErrCodeValidation, "", map[string]string{"age": "max=150"}},
+		{"/plain", nil, cosrpc.ErrCodeInternal, "database down", nil},
+	}
+	for _, mode := range modes {
+		for _, tt := range tests {
+			t.Run(mode.name+tt.method, func(t *testing.T) {
+				_, err := client.InvokeWith[loginArgs](context.Background(), mode.m, mode.servicePath, tt.method, tt.req)
+				var e *cosrpc.Error
+				if !errors.As(err, &e) {
+					t.Fatalf("err = %v (%T), want *cosrpc.Error", err, err)
+				}
+				if e.Code != tt.code {
+					t.Errorf("code = %v, want %v", e.Code, tt.code)
+				}
+				if tt.message != "" && e.Message != tt.message {
+					t.Errorf("message = %q, want %q", e.Message, tt.message)
+				}
+				for k, v := range tt.details {
+					if got := fmt.Sprint(e.Details[k]); got != v {
+						t.Errorf("details[%v] = %v, want %v", k, got, v)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package cosrpc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// MetaDataIdempotency 请求 metadata 中的幂等键
+// 同一个幂等键在服务端的缓存窗口内只执行一次，重试时直接返回第一次的结果
+const MetaDataIdempotency = "_rpc_idempotency"
+
+// NewIdempotencyKey 生成随机幂等键
+func NewIdempotencyKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -9,6 +9,7 @@ import (
 	"reflect"
 
 	"github.com/hwcer/cosgo/binder"
+	"github.com/hwcer/cosrpc"
 	"github.com/hwcer/cosrpc/server"
 	"github.com/smallnest/rpcx/client"
 	"github.com/smallnest/rpcx/protocol"
@@ -16,6 +17,7 @@ import (
 )
 
 type Client struct {
+	auth        string
 	servicePath string
 }
 
@@ -32,7 +34,9 @@ func (c *Client) GetPlugins() client.PluginContainer {
 }
 func (c *Client) SetSelector(s client.Selector)                 {}
 func (c *Client) ConfigGeoSelector(latitude, longitude float64) {}
-func (c *Client) Auth(auth string)                              {}
+func (c *Client) Auth(auth string) {
+	c.auth = auth
+}
 
 func (c *Client) Go(ctx context.Context, serviceMethod string, args interface{}, reply interface{}, done chan *client.Call) (*client.Call, error) {
 	return nil, nil
@@ -44,7 +48,7 @@ func (c *Client) Call(ctx context.Context, serviceMethod string, args any, reply
 	}
 	node, _ := server.Default.Registry.Search(server.RegistryMethod, c.servicePath, serviceMethod)
 	if node == nil {
-		return errors.New("services not found: " + serviceMethod)
+		return cosrpc.NewError(cosrpc.ErrCodeServiceNotFound, "services not found: "+serviceMethod)
 	}
 
 	req := &Request{}
@@ -56,21 +60,11 @@ func (c *Client) Call(ctx context.Context, serviceMethod string, args any, reply
 		req.Args = args
 	}
 
-	sc := &Context{req: req, meta: map[any]any{}}
-
-	if v := ctx.Value(share.ReqMetaDataKey); v != nil {
-		sc.meta[share.ReqMetaDataKey] = v
-	} else {
-		sc.meta[share.ReqMetaDataKey] = make(map[string]string)
-	}
-
-	if v := ctx.Value(share.ResMetaDataKey); v != nil {
-		sc.meta[share.ResMetaDataKey] = v
-	} else {
-		sc.meta[share.ResMetaDataKey] = make(map[string]string)
-	}
-
-	if err = server.Default.Caller(sc, node); err != nil {
+	meta, _ := ctx.Value(share.ReqMetaDataKey).(map[string]string)
+	sc := c.newContext(ctx, req, meta)
+	err = server.Default.Caller(sc, node)
+	c.response(ctx, sc)
+	if err != nil {
 		return err
 	}
 	return Unmarshal(sc.reply, reply)
@@ -95,28 +89,17 @@ func (c *Client) Inform(ctx context.Context, serviceMethod string, args interfac
 func (c *Client) SendRaw(ctx context.Context, r *protocol.Message) (map[string]string, []byte, error) {
 	node, _ := server.Default.Registry.Search(server.RegistryMethod, c.servicePath, r.ServiceMethod)
 	if node == nil {
-		return nil, nil, errors.New("services not found: " + r.ServiceMethod)
+		return nil, nil, cosrpc.NewError(cosrpc.ErrCodeServiceNotFound, "services not found: "+r.ServiceMethod)
 	}
 
 	req := &Request{}
-	req.Args = r
+	req.Payload = r.Payload
 	req.ServicePath = c.servicePath
 	req.ServiceMethod = r.ServiceMethod
-	sc := &Context{req: req, meta: map[any]any{}}
-
-	if v := ctx.Value(share.ReqMetaDataKey); v != nil {
-		sc.meta[share.ReqMetaDataKey] = v
-	} else {
-		sc.meta[share.ReqMetaDataKey] = make(map[string]string)
-	}
-
-	if v := ctx.Value(share.ResMetaDataKey); v != nil {
-		sc.meta[share.ResMetaDataKey] = v
-	} else {
-		sc.meta[share.ResMetaDataKey] = make(map[string]string)
-	}
-
-	if err := server.Default.Caller(sc, node); err != nil {
+	sc := c.newContext(ctx, req, r.Metadata)
+	err := server.Default.Caller(sc, node)
+	res := c.response(ctx, sc)
+	if err != nil {
 		return nil, nil, err
 	}
 
@@ -130,7 +113,35 @@ func (c *Client) SendRaw(ctx context.Context, r *protocol.Message) (map[string]s
 		data, _ = json.Marshal(v)
 	}
 
-	return sc.Metadata(), data, nil
+	return res, data, nil
+}
+
+// newContext 创建进程内调用上下文
+// 与 rpcx 一致，服务端拿到的是请求 metadata 的副本，响应 metadata 写入新的 map
+func (c *Client) newContext(ctx context.Context, req *Request, meta map[string]string) *Context {
+	reqMeta := make(map[string]string, len(meta)+1)
+	for k, v := range meta {
+		reqMeta[k] = v
+	}
+	if c.auth != "" {
+		reqMeta[share.AuthKey] = c.auth
+	}
+	sc := &Context{ctx: ctx, req: req, meta: map[any]any{}}
+	sc.meta[share.ReqMetaDataKey] = reqMeta
+	sc.meta[share.ResMetaDataKey] = make(map[string]string)
+	return sc
+}
+
+// response 返回服务端写入的响应 metadata
+// 与 rpcx 一致，调用方通过 ctx 提供了 share.ResMetaDataKey 时合并到调用方的 map
+func (c *Client) response(ctx context.Context, sc *Context) map[string]string {
+	res, _ := sc.meta[share.ResMetaDataKey].(map[string]string)
+	if meta, ok := ctx.Value(share.ResMetaDataKey).(map[string]string); ok && meta != nil {
+		for k, v := range res {
+			meta[k] = v
+		}
+	}
+	return res
 }
 func (c *Client) SendFile(ctx context.Context, fileName string, rateInBytesPerSecond int64, meta map[string]string) error {
 	return nil
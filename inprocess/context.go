@@ -1,16 +1,24 @@
 package inprocess
 
 import (
+	"context"
+
 	"github.com/hwcer/cosgo/binder"
 	"github.com/smallnest/rpcx/share"
 )
 
 type Context struct {
+	ctx   context.Context
 	req   *Request
 	meta  map[any]any
 	reply any
 }
 
+// Context returns the caller's context, carrying its deadline and cancellation.
+func (ctx *Context) Context() context.Context {
+	return ctx.ctx
+}
+
 // Get returns value for key.
 func (ctx *Context) Get(key any) any {
 	return ctx.meta[key]
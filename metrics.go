@@ -0,0 +1,206 @@
+package cosrpc
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 指标记录方
+const (
+	MetricSideClient = SpanKindClient
+	MetricSideServer = SpanKindServer
+)
+
+// MetricUnknown 服务端未找到路由的请求统一使用的服务和方法标签，避免调用方任意构造的名称产生无限多的指标
+const MetricUnknown = "_unknown"
+
+// MetricsBuckets 耗时直方图的桶(秒)
+var MetricsBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics 当前的指标记录器，为空时不记录
+var metrics Metrics = NewMetricsRegistry()
+
+// Metric 一次调用的指标
+type Metric struct {
+	Side          string        //client 或 server
+	ServicePath   string        //服务路径
+	ServiceMethod string        //服务方法
+	Code          int32         //错误码，成功时为 0
+	Latency       time.Duration //耗时
+	RequestSize   int           //请求体长度
+	ResponseSize  int           //响应体长度
+}
+
+// Metrics 指标记录器，可以通过 SetMetrics 替换为其他实现(如对接 go-metrics 或 OpenTelemetry)
+type Metrics interface {
+	Observe(m *Metric)
+}
+
+// SetMetrics 设置指标记录器，nil 时关闭记录
+func SetMetrics(m Metrics) {
+	metrics = m
+}
+
+// GetMetrics 获取指标记录器
+func GetMetrics() Metrics {
+	return metrics
+}
+
+// Observe 记录一次调用
+func Observe(m *Metric) {
+	if metrics != nil {
+		m.ServiceMethod = strings.Trim(m.ServiceMethod, "/")
+		metrics.Observe(m)
+	}
+}
+
+// MetricsHandler 以 Prometheus 文本格式输出指标
+// 指标记录器没有实现 http.Handler 时返回 404
+//
+//	http.Handle("/metrics", cosrpc.MetricsHandler())
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := metrics.(http.Handler); ok {
+			h.ServeHTTP(w, r)
+		} else {
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// NewMetricsRegistry 创建内置的指标记录器
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{dict: map[metricKey]*metricValue{}}
+}
+
+// MetricsRegistry 内置指标记录器，按记录方、服务和方法统计请求数、错误数、耗时直方图和数据量
+type MetricsRegistry struct {
+	dict  map[metricKey]*metricValue
+	mutex sync.RWMutex
+}
+
+type metricKey struct {
+	side    string
+	service string
+	method  string
+}
+
+type metricValue struct {
+	mutex    sync.Mutex
+	requests uint64
+	errors   map[int32]uint64
+	buckets  []uint64
+	latency  float64
+	reqBytes uint64
+	resBytes uint64
+}
+
+func (this *MetricsRegistry) value(k metricKey) *metricValue {
+	this.mutex.RLock()
+	v := this.dict[k]
+	this.mutex.RUnlock()
+	if v != nil {
+		return v
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if v = this.dict[k]; v == nil {
+		v = &metricValue{errors: map[int32]uint64{}, buckets: make([]uint64, len(MetricsBuckets))}
+		this.dict[k] = v
+	}
+	return v
+}
+
+func (this *MetricsRegistry) Observe(m *Metric) {
+	v := this.value(metricKey{side: m.Side, service: m.ServicePath, method: m.ServiceMethod})
+	seconds := m.Latency.Seconds()
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.requests++
+	if m.Code != 0 {
+		v.errors[m.Code]++
+	}
+	for i, le := range MetricsBuckets {
+		if seconds <= le {
+			v.buckets[i]++
+		}
+	}
+	v.latency += seconds
+	v.reqBytes += uint64(m.RequestSize)
+	v.resBytes += uint64(m.ResponseSize)
+}
+
+// ServeHTTP 以 Prometheus 文本格式输出
+func (this *MetricsRegistry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	this.Export(w)
+}
+
+// Export 以 Prometheus 文本格式写入 w
+func (this *MetricsRegistry) Export(w io.Writer) {
+	this.mutex.RLock()
+	keys := make([]metricKey, 0, len(this.dict))
+	values := make(map[metricKey]*metricValue, len(this.dict))
+	for k, v := range this.dict {
+		keys = append(keys, k)
+		values[k] = v
+	}
+	this.mutex.RUnlock()
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].side != keys[j].side {
+			return keys[i].side < keys[j].side
+		}
+		if keys[i].service != keys[j].service {
+			return keys[i].service < keys[j].service
+		}
+		return keys[i].method < keys[j].method
+	})
+
+	var requests, errors, latency, reqBytes, resBytes strings.Builder
+	for _, k := range keys {
+		v := values[k]
+		labels := fmt.Sprintf(`side="%s",service="%s",method="%s"`, metricEscape(k.side), metricEscape(k.service), metricEscape(k.method))
+		v.mutex.Lock()
+		fmt.Fprintf(&requests, "cosrpc_requests_total{%s} %d\n", labels, v.requests)
+		codes := make([]int32, 0, len(v.errors))
+		for code := range v.errors {
+			codes = append(codes, code)
+		}
+		sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+		for _, code := range codes {
+			fmt.Fprintf(&errors, "cosrpc_errors_total{%s,code=\"%d\"} %d\n", labels, code, v.errors[code])
+		}
+		for i, le := range MetricsBuckets {
+			fmt.Fprintf(&latency, "cosrpc_latency_seconds_bucket{%s,le=\"%s\"} %d\n", labels, strconv.FormatFloat(le, 'g', -1, 64), v.buckets[i])
+		}
+		fmt.Fprintf(&latency, "cosrpc_latency_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, v.requests)
+		fmt.Fprintf(&latency, "cosrpc_latency_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(v.latency, 'g', -1, 64))
+		fmt.Fprintf(&latency, "cosrpc_latency_seconds_count{%s} %d\n", labels, v.requests)
+		fmt.Fprintf(&reqBytes, "cosrpc_request_bytes_total{%s} %d\n", labels, v.reqBytes)
+		fmt.Fprintf(&resBytes, "cosrpc_response_bytes_total{%s} %d\n", labels, v.resBytes)
+		v.mutex.Unlock()
+	}
+
+	metricWrite(w, "cosrpc_requests_total", "counter", "Total number of calls.", requests.String())
+	metricWrite(w, "cosrpc_errors_total", "counter", "Total number of failed calls by error code.", errors.String())
+	metricWrite(w, "cosrpc_latency_seconds", "histogram", "Call latency in seconds.", latency.String())
+	metricWrite(w, "cosrpc_request_bytes_total", "counter", "Total request payload bytes.", reqBytes.String())
+	metricWrite(w, "cosrpc_response_bytes_total", "counter", "Total response payload bytes.", resBytes.String())
+}
+
+func metricWrite(w io.Writer, name, typ, help, body string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	_, _ = io.WriteString(w, body)
+}
+
+var metricReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func metricEscape(s string) string {
+	return metricReplacer.Replace(s)
+}
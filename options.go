@@ -11,6 +11,10 @@ var rpcServerAddress *utils.Address
 
 var Config = &Options{
 	Timeout:             10,
+	DrainTimeout:        5,
+	CompressThreshold:   1024,
+	SlowSample:          1,
+	SlowLimit:           10,
 	Network:             "tcp",
 	Address:             ":8100",
 	ClientMessageChan:   300,
@@ -18,41 +22,91 @@ var Config = &Options{
 }
 
 type Options = struct {
-	Timeout             int32  `json:"timeout"`
-	Network             string `json:"network"`
-	Address             string `json:"address"` //仅仅启动服务器时需要
-	ClientMessageChan   int    //双向通信客户端接受消息通道大小
-	ClientMessageWorker int    //双向通信客户端处理消息协程数量
+	Timeout             int32             `json:"timeout"`
+	DrainTimeout        int32             `json:"drainTimeout"` //关闭服务器时等待进行中请求的最长时间(秒)
+	Network             string            `json:"network"`
+	Address             string            `json:"address"`           //仅仅启动服务器时需要
+	Token               string            `json:"token"`             //服务间认证令牌，为空时不认证
+	Tokens              map[string]string `json:"tokens"`            //按服务路径设置的认证令牌，优先于 Token
+	TLS                 *TLSOptions       `json:"tls"`               //TLS 配置，为空时不启用
+	Compress            string            `json:"compress"`          //请求体和响应体压缩算法: none,gzip,snappy
+	Compresses          map[string]string `json:"compresses"`        //按服务路径设置的压缩算法，优先于 Compress
+	CompressThreshold   int               `json:"compressThreshold"` //数据达到该长度才压缩
+	MaxPayload          int               `json:"maxPayload"`        //请求体最大长度(压缩时为解压后的长度)，0 不限制
+	MaxPayloads         map[string]int    `json:"maxPayloads"`       //按服务路径设置的请求体最大长度，优先于 MaxPayload
+	SlowCall            int32             `json:"slowCall"`          //调用耗时超过该值(毫秒)时记录日志，0 不记录
+	SlowPayload         int               `json:"slowPayload"`       //请求体或响应体超过该长度时记录日志，0 不记录
+	SlowSample          float64           `json:"slowSample"`        //慢调用日志采样率(0,1]
+	SlowLimit           int               `json:"slowLimit"`         //每秒最多记录的慢调用日志数量，0 不限制
+	SlowMetadata        []string          `json:"slowMetadata"`      //慢调用日志中记录的请求 metadata 字段
+	ClientMessageChan   int               //双向通信客户端接受消息通道大小
+	ClientMessageWorker int               //双向通信客户端处理消息协程数量
 }
 
 func Address() *utils.Address {
 	if rpcServerAddress != nil {
 		return rpcServerAddress
 	}
-	rpcServerAddress = utils.NewAddress(Config.Address)
-	if rpcServerAddress.Retry == 0 {
-		rpcServerAddress.Retry = 100
+	rpcServerAddress = NewAddress(Config.Network, Config.Address)
+	return rpcServerAddress
+}
+
+// NewAddress 解析服务器监听地址
+func NewAddress(network, address string) *utils.Address {
+	addr := utils.NewAddress(address)
+	if addr.Retry == 0 {
+		addr.Retry = 100
 	}
-	if rpcServerAddress.Host == "" {
-		rpcServerAddress.Host = "0.0.0.0"
+	if addr.Host == "" {
+		addr.Host = "0.0.0.0"
 	}
-	rpcServerAddress.Scheme = Config.Network
-	return rpcServerAddress
+	addr.Scheme = network
+	return addr
 }
 
 func Timeout() time.Duration {
 	return time.Second * time.Duration(Config.Timeout)
 }
 
+func DrainTimeout() time.Duration {
+	return time.Second * time.Duration(Config.DrainTimeout)
+}
+
+// Token 服务的认证令牌，客户端发送、服务端校验
+func Token(servicePath string) string {
+	if v, ok := Config.Tokens[servicePath]; ok {
+		return v
+	}
+	return Config.Token
+}
+
+// MaxPayload 服务的请求体最大长度，0 不限制
+func MaxPayload(servicePath string) int {
+	if v, ok := Config.MaxPayloads[servicePath]; ok {
+		return v
+	}
+	return Config.MaxPayload
+}
+
 func AddressPrefix() string {
 	return Config.Network + "@"
 }
 
+// networks rpcx 支持的网络类型
+var networks = map[string]bool{
+	"tcp": true, "tcp4": true, "tcp6": true, "http": true, "ws": true, "wss": true, "kcp": true,
+	"quic": true, "unix": true, "reuseport": true, "memu": true, "iouring": true, "utp": true,
+}
+
+// AddressFormat 为地址添加网络类型前缀，已经指定了 rpcx 支持的网络类型(如 memu@name)时原样返回
 func AddressFormat(address string) string {
 	prefix := AddressPrefix()
 	if strings.HasPrefix(address, prefix) {
 		return address
 	}
+	if i := strings.Index(address, "@"); i > 0 && networks[address[:i]] {
+		return address
+	}
 	b := strings.Builder{}
 	b.WriteString(prefix)
 	b.WriteString(address)
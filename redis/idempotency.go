@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"time"
+
+	xserver "github.com/hwcer/cosrpc/server"
+	"github.com/rpcxio/libkv"
+	"github.com/rpcxio/libkv/store"
+	"github.com/smallnest/rpcx/log"
+)
+
+// IdempotencyStore 基于 redis 的幂等结果存储，多个节点共享，Failover 重试到其他节点时同样生效
+//
+//	s, err := redis.NewIdempotencyStore()
+//	server.Default.Idempotency.Set(s, time.Minute)
+type IdempotencyStore struct {
+	prefix string
+	kv     store.Store
+}
+
+var _ xserver.IdempotencyStore = (*IdempotencyStore)(nil)
+
+// NewIdempotencyStore 使用 rpcx.redis 配置创建幂等结果存储
+func NewIdempotencyStore() (*IdempotencyStore, error) {
+	address, opt, err := rpcxRedisParse()
+	if err != nil {
+		return nil, err
+	}
+	kv, err := libkv.NewStore(store.REDIS, address, opt)
+	if err != nil {
+		return nil, err
+	}
+	return &IdempotencyStore{prefix: Options.Appid + "/_idempotency", kv: kv}, nil
+}
+
+func (s *IdempotencyStore) Get(key string) ([]byte, bool) {
+	pair, err := s.kv.Get(s.prefix + key)
+	if err != nil {
+		if err != store.ErrKeyNotFound {
+			log.Errorf("idempotency get error:%v", err)
+		}
+		return nil, false
+	}
+	return pair.Value, true
+}
+
+func (s *IdempotencyStore) Set(key string, data []byte, ttl time.Duration) {
+	if err := s.kv.Put(s.prefix+key, data, &store.WriteOptions{TTL: ttl}); err != nil {
+		log.Errorf("idempotency set error:%v", err)
+	}
+}
+
+// Claim 使用 SETNX 占用幂等键，redis 出错时返回 true，由本节点执行
+func (s *IdempotencyStore) Claim(key string, ttl time.Duration) bool {
+	ok, _, err := s.kv.AtomicPut(s.prefix+key+"/claim", []byte{1}, nil, &store.WriteOptions{TTL: ttl})
+	if err != nil && err != store.ErrKeyExists {
+		log.Errorf("idempotency claim error:%v", err)
+		return true
+	}
+	return ok
+}
+
+// Release 释放 Claim 占用的幂等键
+func (s *IdempotencyStore) Release(key string) {
+	if err := s.kv.Delete(s.prefix + key + "/claim"); err != nil && err != store.ErrKeyNotFound {
+		log.Errorf("idempotency release error:%v", err)
+	}
+}
+
+// Close 关闭 redis 连接
+func (s *IdempotencyStore) Close() {
+	s.kv.Close()
+}
@@ -70,7 +70,22 @@ func GetDiscovery(servicePath string) (client.ServiceDiscovery, error) {
 }
 
 func GetRegister() (xserver.Register, error) {
-	rpcxAddr := cosrpc.Address()
+	return NewRegister(Options.Appid, cosrpc.Address())
+}
+
+// ServerRegister 用于 server.Options.Register，按服务器自身的监听地址和 Appid 注册
+//
+//	srv := server.New(server.Options{Address: ":8200", Appid: "internal", Register: redis.ServerRegister})
+func ServerRegister(s *xserver.Server) (xserver.Register, error) {
+	appid := s.Options.Appid
+	if appid == "" {
+		appid = Options.Appid
+	}
+	return NewRegister(appid, s.Endpoint())
+}
+
+// NewRegister 创建 redis 服务注册器，rpcxAddr 为服务器监听地址
+func NewRegister(appid string, rpcxAddr *utils.Address) (xserver.Register, error) {
 	address, opt, err := rpcxRedisParse()
 	if err != nil {
 		return nil, err
@@ -83,9 +98,9 @@ func GetRegister() (xserver.Register, error) {
 		return nil, err
 	}
 	rpcxRegister := &Register{
-		ServiceAddress: fmt.Sprintf("%v%v:%v", cosrpc.AddressPrefix(), host, rpcxAddr.Port),
+		ServiceAddress: fmt.Sprintf("%v@%v:%v", rpcxAddr.Scheme, host, rpcxAddr.Port),
 		RedisServers:   address,
-		BasePath:       Options.Appid,
+		BasePath:       appid,
 		Options:        opt,
 		UpdateInterval: time.Second,
 	}
@@ -89,11 +89,11 @@ func (p *Register) Start() error {
 						extra["connections"] = fmt.Sprintf("%.2f", metrics.GetOrRegisterMeter("connections", p.Metrics).RateMean())
 					}
 					//set this same metrics for all services at this server
-					for _, name := range p.Services {
+					for _, name := range p.services() {
 						nodePath := fmt.Sprintf("%s/%s/%s", p.BasePath, name, p.ServiceAddress)
 						kvPair, err := p.kv.Get(nodePath)
 						if err != nil {
-							log.Debug("can't get data of node: %s, because of %v", nodePath, err.Error())
+							log.Debugf("can't get data of node: %s, because of %v", nodePath, err.Error())
 
 							p.metasLock.RLock()
 							meta := p.metas[name]
@@ -131,7 +131,7 @@ func (p *Register) Stop() error {
 		p.kv = kv
 	}
 
-	for _, name := range p.Services {
+	for _, name := range p.services() {
 		nodePath := fmt.Sprintf("%s/%s/%s", p.BasePath, name, p.ServiceAddress)
 		exist, err := p.kv.Exists(nodePath)
 		if err != nil {
@@ -204,19 +204,28 @@ func (p *Register) Register(name string, rcvr interface{}, metadata string) (err
 		return err
 	}
 
-	p.Services = append(p.Services, name)
-
 	p.metasLock.Lock()
 	if p.metas == nil {
 		p.metas = make(map[string]string)
 	}
+	if _, ok := p.metas[name]; !ok {
+		p.Services = append(p.Services, name)
+	}
 	p.metas[name] = metadata
 	p.metasLock.Unlock()
 	return
 }
 
+// services returns a snapshot of the registered services,
+// services may be registered or unregistered while the server is running.
+func (p *Register) services() []string {
+	p.metasLock.RLock()
+	defer p.metasLock.RUnlock()
+	return append([]string(nil), p.Services...)
+}
+
 func (p *Register) Unregister(name string) (err error) {
-	if len(p.Services) == 0 {
+	if len(p.services()) == 0 {
 		return nil
 	}
 
@@ -256,15 +265,14 @@ func (p *Register) Unregister(name string) (err error) {
 		return err
 	}
 
-	var services = make([]string, 0, len(p.Services)-1)
+	p.metasLock.Lock()
+	var services = make([]string, 0, len(p.Services))
 	for _, s := range p.Services {
 		if s != name {
 			services = append(services, s)
 		}
 	}
 	p.Services = services
-
-	p.metasLock.Lock()
 	if p.metas == nil {
 		p.metas = make(map[string]string)
 	}
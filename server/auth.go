@@ -0,0 +1,47 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/logger"
+	"github.com/smallnest/rpcx/share"
+)
+
+// ErrUnauthorized 认证失败
+var ErrUnauthorized = values.Errorf(cosrpc.ErrCodeUnauthorized, "unauthorized")
+
+// Authenticator 服务间认证
+// token 为客户端通过 rpcx Auth 发送的令牌，校验通过时返回调用方身份(principal)
+// 返回的 principal 可以在处理器中通过 cosrpc.Context.Principal() 获取
+type Authenticator func(c *cosrpc.Context, token string) (principal string, err error)
+
+// TokenAuthenticator 默认认证器
+// 与 cosrpc.Token(servicePath) 比对，服务未配置令牌时不认证
+func TokenAuthenticator(c *cosrpc.Context, token string) (principal string, err error) {
+	expected := cosrpc.Token(c.ServicePath())
+	if expected == "" {
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(token)) != 1 {
+		err = errors.New("invalid token")
+	}
+	return
+}
+
+// authenticate 认证请求，认证通过后将 principal 写入上下文
+func (xs *Server) authenticate(c *cosrpc.Context) bool {
+	auth := xs.Authenticator
+	if auth == nil {
+		auth = TokenAuthenticator
+	}
+	principal, err := auth(c, c.GetMetadata(share.AuthKey))
+	if err != nil {
+		logger.Debug("rpc server authenticate failed:%v%v %v", c.ServicePath(), c.ServiceMethod(), err)
+		return false
+	}
+	c.SetValue(cosrpc.PrincipalContextKey, principal)
+	return true
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/cosrpc"
+)
+
+// ErrServiceBusy 服务或方法的并发数达到上限
+var ErrServiceBusy = values.Errorf(cosrpc.ErrCodeServiceBusy, "service busy")
+
+// ErrDeadline 排队等待并发许可时调用方已经超时或取消，调用方不再需要结果，不应重试
+var ErrDeadline = values.Errorf(cosrpc.ErrCodeDeadline, "deadline exceeded")
+
+// NewBulkhead 创建并发限制器
+func NewBulkhead() *Bulkhead {
+	return &Bulkhead{dict: map[string]*bulkhead{}}
+}
+
+// Bulkhead 并发限制器(舱壁)
+// 按服务路径和服务方法限制同时处理的请求数量，防止单个慢接口耗尽协程拖垮同一 Registry 中的其他服务
+type Bulkhead struct {
+	dict  map[string]*bulkhead
+	mutex sync.RWMutex
+}
+
+type bulkhead struct {
+	sem  chan struct{}
+	wait time.Duration
+}
+
+// acquire 获取许可，排队时调用方的截止时间先到达或者取消时不再等待
+func (b *bulkhead) acquire(ctx context.Context) bool {
+	select {
+	case b.sem <- struct{}{}:
+		return true
+	default:
+	}
+	if b.wait <= 0 {
+		return false
+	}
+	t := time.NewTimer(b.wait)
+	defer t.Stop()
+	select {
+	case b.sem <- struct{}{}:
+		return true
+	case <-t.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (b *bulkhead) release() {
+	<-b.sem
+}
+
+// Set 设置并发上限
+// name 为服务路径(user)或服务路径加方法(user/login)，max <= 0 时取消限制
+// wait > 0 时达到上限的请求排队等待，超时后返回 ErrServiceBusy，调用方的截止时间先到达时返回 ErrDeadline
+func (this *Bulkhead) Set(name string, max int, wait time.Duration) {
+	name = strings.Trim(name, "/")
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if max <= 0 {
+		delete(this.dict, name)
+	} else {
+		this.dict[name] = &bulkhead{sem: make(chan struct{}, max), wait: wait}
+	}
+}
+
+func (this *Bulkhead) get(servicePath, serviceMethod string) (s, m *bulkhead) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	if len(this.dict) == 0 {
+		return
+	}
+	return this.dict[servicePath], this.dict[servicePath+serviceMethod]
+}
+
+// Acquire 依次获取服务和方法的并发许可，ctx 为请求的 context(参见 cosrpc.Context.Context)，排队时最多等到其截止时间
+// 成功时返回释放函数，任意一个达到上限时返回 false
+func (this *Bulkhead) Acquire(ctx context.Context, servicePath, serviceMethod string) (release func(), ok bool) {
+	s, m := this.get(servicePath, serviceMethod)
+	if s == nil && m == nil {
+		return func() {}, true
+	}
+	if s != nil && !s.acquire(ctx) {
+		return nil, false
+	}
+	if m != nil && !m.acquire(ctx) {
+		if s != nil {
+			s.release()
+		}
+		return nil, false
+	}
+	return func() {
+		if m != nil {
+			m.release()
+		}
+		if s != nil {
+			s.release()
+		}
+	}, true
+}
@@ -0,0 +1,80 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/cosrpc/cosrpctest"
+)
+
+// newSlowServer 启动服务 slow，/wait 阻塞到 release 关闭
+func newSlowServer(t *testing.T) (ts *cosrpctest.Server, started chan struct{}, release chan struct{}) {
+	ts = cosrpctest.New(t)
+	started, release = make(chan struct{}, 10), make(chan struct{})
+	wait := func(c *cosrpc.Context) any {
+		started <- struct{}{}
+		<-release
+		return "done"
+	}
+	if err := ts.Service("slow").Register(wait, "/wait"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestBulkhead(t *testing.T) {
+	ts, started, release := newSlowServer(t)
+	ts.Bulkhead.Set("slow", 1, 0)
+	done := make(chan error, 1)
+	go func() {
+		_, err := cosrpctest.Invoke[string](context.Background(), ts, "slow", "/wait", nil)
+		done <- err
+	}()
+	<-started
+	_, err := cosrpctest.Invoke[string](context.Background(), ts, "slow", "/wait", nil)
+	var e *cosrpc.Error
+	if !errors.As(err, &e) || e.Code != cosrpc.ErrCodeServiceBusy {
+		t.Errorf("err = %v, want ErrCodeServiceBusy", err)
+	}
+	close(release)
+	if err = <-done; err != nil {
+		t.Errorf("first call: %v", err)
+	}
+}
+
+func TestBulkheadDeadline(t *testing.T) {
+	ts, started, release := newSlowServer(t)
+	ts.Bulkhead.Set("slow", 1, time.Minute)
+	done := make(chan error, 1)
+	go func() {
+		_, err := cosrpctest.Invoke[string](context.Background(), ts, "slow", "/wait", nil)
+		done <- err
+	}()
+	// 第一个请求完成后再关闭服务器，否则 rpcx 会因为连接关闭移除客户端
+	defer func() {
+		close(release)
+		<-done
+	}()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := cosrpctest.Invoke[string](ctx, ts, "slow", "/wait", nil)
+	var e *cosrpc.Error
+	if err == nil || errors.As(err, &e) && e.Code != cosrpc.ErrCodeDeadline {
+		t.Fatalf("err = %v, want deadline error", err)
+	}
+	// 排队的请求在调用方截止时间到达后离开队列，而不是等待 wait 配置的一分钟
+	deadline := time.Now().Add(2 * time.Second)
+	for ts.Inflight() > 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("inflight = %v, queued request still waiting after the caller deadline", ts.Inflight())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -10,6 +10,8 @@ var Default = New()
 func init() {
 	cosgo.On(cosgo.EventTypStarted, Default.Start)
 	cosgo.On(cosgo.EventTypClosing, Default.Close)
+	cosgo.On(cosgo.EventTypLoaded, Default.RateLimit.Reload)
+	cosgo.On(cosgo.EventTypReload, Default.RateLimit.Reload)
 }
 
 var defaultRegister func() (Register, error)
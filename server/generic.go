@@ -0,0 +1,29 @@
+package server
+
+import (
+	"github.com/hwcer/cosgo/registry"
+	"github.com/hwcer/cosrpc"
+)
+
+// HandlerFunc 带错误返回的函数处理器
+// 由 Handle 生成，Handler.Caller 直接调用，不经过反射
+type HandlerFunc func(c *cosrpc.Context) (interface{}, error)
+
+// Handle 注册一个强类型处理器
+// 请求体使用协商后的 Binder 解码到 Req，返回的 Resp 按默认规则序列化
+//
+//	server.Handle(svc, "/login", func(c *cosrpc.Context, req *LoginArgs) (*LoginReply, error) {...})
+func Handle[Req any, Resp any](svc *registry.Service, path string, fn func(c *cosrpc.Context, req *Req) (*Resp, error)) error {
+	var f HandlerFunc = func(c *cosrpc.Context) (interface{}, error) {
+		req := new(Req)
+		if err := c.Bind(req); err != nil {
+			return nil, err
+		}
+		reply, err := fn(c, req)
+		if err != nil || reply == nil {
+			return nil, err
+		}
+		return reply, nil
+	}
+	return svc.Register(f, path)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/hwcer/cosgo/values"
 	"github.com/hwcer/cosrpc"
 	"github.com/hwcer/logger"
+	"github.com/smallnest/rpcx/share"
 )
 
 // HandlerFilter 定义服务过滤器
@@ -27,6 +28,11 @@ type HandlerMetadata func() string
 // 用于处理请求前的逻辑，如认证、日志等
 type HandlerMiddleware func(*cosrpc.Context) error
 
+// HandlerInterceptor 定义服务拦截器
+// 包裹 Middleware 与 Caller，next 返回业务方法的 reply 和 err
+// 可用于审计日志、改写响应、错误码映射和耗时统计
+type HandlerInterceptor func(c *cosrpc.Context, next func() (interface{}, error)) (interface{}, error)
+
 // HandlerSerialize 定义服务序列化器
 // 用于序列化响应数据
 type HandlerSerialize func(c *cosrpc.Context, reply interface{}) ([]byte, error)
@@ -40,11 +46,12 @@ type handleCaller interface {
 // Handler 是 cosrpc 服务器的处理器
 // 支持多种处理器类型，如调用器、过滤器、元数据、中间件和序列化器
 type Handler struct {
-	caller     HandlerCaller       // 服务调用器
-	filter     HandlerFilter       // 服务过滤器
-	metadata   []HandlerMetadata   // 服务元数据提供者
-	middleware []HandlerMiddleware // 服务中间件
-	serialize  HandlerSerialize    // 服务序列化器
+	caller     HandlerCaller        // 服务调用器
+	filter     HandlerFilter        // 服务过滤器
+	metadata   []HandlerMetadata    // 服务元数据提供者
+	middleware []HandlerMiddleware  // 服务中间件
+	serialize  HandlerSerialize     // 服务序列化器
+	intercept  []HandlerInterceptor // 服务拦截器
 }
 
 // Use 应用一个处理器
@@ -65,6 +72,9 @@ func (this *Handler) Use(src interface{}) {
 	if v, ok := src.(HandlerSerialize); ok {
 		this.serialize = v
 	}
+	if v, ok := src.(HandlerInterceptor); ok {
+		this.intercept = append(this.intercept, v)
+	}
 }
 
 // Filter 过滤节点
@@ -75,8 +85,12 @@ func (this *Handler) Filter(node *registry.Node) bool {
 		return this.filter(node)
 	}
 	if node.IsFunc() {
-		_, ok := node.Method().(func(*cosrpc.Context) interface{})
-		return ok
+		switch node.Method().(type) {
+		case func(*cosrpc.Context) interface{}, HandlerFunc:
+			return true
+		default:
+			return false
+		}
 	} else if node.IsMethod() {
 		t := node.Value().Type()
 		if t.NumIn() != 2 || t.NumOut() != 1 {
@@ -109,7 +123,7 @@ func (this *Handler) Metadata() string {
 func (this *Handler) Caller(node *registry.Node, c *cosrpc.Context) (reply interface{}, err error) {
 	defer func() {
 		if e := recover(); e != nil {
-			err = values.Errorf(500, "server recover error")
+			err = values.Errorf(cosrpc.ErrCodeInternal, "server recover error")
 			logger.Error(e)
 		}
 	}()
@@ -122,8 +136,12 @@ func (this *Handler) Caller(node *registry.Node, c *cosrpc.Context) (reply inter
 		return this.caller(node, c)
 	}
 	if node.IsFunc() {
-		m := node.Method().(func(*cosrpc.Context) interface{})
-		reply = m(c)
+		switch m := node.Method().(type) {
+		case HandlerFunc:
+			reply, err = m(c)
+		case func(*cosrpc.Context) interface{}:
+			reply = m(c)
+		}
 	} else if s, ok := node.Binder().(handleCaller); ok {
 		reply = s.Caller(node, c)
 	} else {
@@ -133,23 +151,102 @@ func (this *Handler) Caller(node *registry.Node, c *cosrpc.Context) (reply inter
 	return
 }
 
+// Invoke 执行拦截器链、Caller 和 Serialize，返回的 data 未压缩，由调用方按需压缩
+// 拦截器按注册顺序由外向内包裹 Caller 和 Serialize，next 返回业务方法的 reply，序列化失败时返回序列化错误
+// 拦截器改写 reply 时重新序列化，未注册拦截器时直接调用 Caller 和 Serialize
+// 拦截器 panic 时返回 ErrCodeInternal 错误
+func (this *Handler) Invoke(node *registry.Node, c *cosrpc.Context) (reply interface{}, data []byte, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			reply, data = nil, nil
+			err = values.Errorf(cosrpc.ErrCodeInternal, "server recover error")
+			logger.Error(e)
+		}
+	}()
+	var marshaled interface{}
+	next := func() (interface{}, error) {
+		r, e := this.Caller(node, c)
+		if e != nil {
+			return r, e
+		}
+		if data, e = this.Serialize(c, r); e != nil {
+			return nil, e
+		}
+		marshaled = r
+		return r, nil
+	}
+	for i := len(this.intercept) - 1; i >= 0; i-- {
+		f, n := this.intercept[i], next
+		next = func() (interface{}, error) {
+			return f(c, n)
+		}
+	}
+	if reply, err = next(); err != nil {
+		return nil, nil, err
+	}
+	if !identical(reply, marshaled) {
+		data, err = this.Serialize(c, reply)
+	}
+	return
+}
+
+// identical 拦截器是否原样返回了 next 的 reply，无法比较的类型(map、切片)视为已改写
+func identical(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	return va.Type() == vb.Type() && va.Comparable() && vb.Comparable() && va.Equal(vb)
+}
+
 // Marshal 序列化响应数据
+// 1. 调用 Serialize 序列化
+// 2. 调用方声明了 MetaDataAcceptCompress 且数据达到阈值时压缩
+func (this *Handler) Marshal(c *cosrpc.Context, reply any) (data []byte, err error) {
+	if data, err = this.Serialize(c, reply); err != nil || data == nil {
+		return
+	}
+	return this.compress(c, data)
+}
+
+// Serialize 序列化响应数据，不压缩
 // 1. 如果有自定义序列化器，使用自定义序列化器
 // 2. 否则，根据响应类型进行默认序列化
-func (this *Handler) Marshal(c *cosrpc.Context, reply any) (data []byte, err error) {
+// 已经序列化的结果(幂等缓存)直接返回
+func (this *Handler) Serialize(c *cosrpc.Context, reply any) (data []byte, err error) {
 	if reply == nil {
 		return
 	}
 	if this.serialize != nil {
-		return this.serialize(c, reply)
-	}
-	switch v := reply.(type) {
-	case []byte:
-		data = v
-	case *[]byte:
-		data = *v
-	default:
-		data, err = c.Binder(binder.HeaderAccept, binder.HeaderContentType).Marshal(values.Parse(reply))
+		data, err = this.serialize(c, reply)
+	} else {
+		switch v := reply.(type) {
+		case []byte:
+			data = v
+		case *[]byte:
+			data = *v
+		default:
+			data, err = c.Binder(binder.HeaderAccept, binder.HeaderContentType).Marshal(values.Parse(reply))
+		}
 	}
 	return
 }
+
+// compress 按调用方声明的算法压缩响应，并在响应 metadata 中标记
+// in-process 模式(没有网络连接)不压缩
+func (this *Handler) compress(c *cosrpc.Context, data []byte) ([]byte, error) {
+	name := c.GetMetadata(cosrpc.MetaDataAcceptCompress)
+	if name == "" || name == cosrpc.CompressNone || c.Conn() == nil || !cosrpc.Compressible(data) {
+		// 重新序列化时清除上一次压缩的标记
+		if meta, _ := c.GetValue(share.ResMetaDataKey).(map[string]string); meta != nil {
+			delete(meta, cosrpc.MetaDataCompress)
+		}
+		return data, nil
+	}
+	zip, err := cosrpc.Compress(name, data)
+	if err != nil {
+		return nil, err
+	}
+	c.SetMetadata(cosrpc.MetaDataCompress, name)
+	return zip, nil
+}
@@ -0,0 +1,70 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/cosrpc/cosrpctest"
+	"github.com/hwcer/cosrpc/server"
+)
+
+type echoReply struct {
+	Hello string `json:"hello"`
+}
+
+func hello(c *cosrpc.Context) any {
+	return &echoReply{Hello: "cosrpc"}
+}
+
+func TestHandlerInterceptor(t *testing.T) {
+	ts := cosrpctest.New(t)
+	var order []string
+	outer := server.HandlerInterceptor(func(c *cosrpc.Context, next func() (interface{}, error)) (interface{}, error) {
+		order = append(order, "outer")
+		return next()
+	})
+	rewrite := server.HandlerInterceptor(func(c *cosrpc.Context, next func() (interface{}, error)) (interface{}, error) {
+		order = append(order, "rewrite")
+		reply, err := next()
+		if err != nil {
+			return nil, err
+		}
+		return &echoReply{Hello: reply.(*echoReply).Hello + "!"}, nil
+	})
+	if err := ts.Service("echo", outer, rewrite).Register(hello, "/hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Start(); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := cosrpctest.Invoke[echoReply](context.Background(), ts, "echo", "/hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Hello != "cosrpc!" {
+		t.Errorf("reply = %+v, want rewritten reply", reply)
+	}
+	if len(order) != 2 || order[0] != "outer" || order[1] != "rewrite" {
+		t.Errorf("order = %v, want [outer rewrite]", order)
+	}
+}
+
+func TestHandlerInterceptorPanic(t *testing.T) {
+	ts := cosrpctest.New(t)
+	crash := server.HandlerInterceptor(func(c *cosrpc.Context, next func() (interface{}, error)) (interface{}, error) {
+		panic("interceptor crashed")
+	})
+	if err := ts.Service("echo", crash).Register(hello, "/hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Start(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := cosrpctest.Invoke[echoReply](context.Background(), ts, "echo", "/hello", nil)
+	var e *cosrpc.Error
+	if !errors.As(err, &e) || e.Code != cosrpc.ErrCodeInternal {
+		t.Fatalf("err = %v, want ErrCodeInternal", err)
+	}
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/hwcer/cosgo/registry"
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/logger"
+)
+
+// IdempotencyStore 幂等请求结果存储
+// 内存存储使用 NewIdempotencyMemory，多节点共享使用 redis.NewIdempotencyStore
+// Claim 原子地占用正在执行的幂等键(如 redis SETNX)，其他节点在 Release 或者 ttl 过期前 Claim 返回 false，
+// 多节点共享的存储通过 Claim 保证 Failover 重试到其他节点时不会并发执行
+type IdempotencyStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, data []byte, ttl time.Duration)
+	Claim(key string, ttl time.Duration) bool
+	Release(key string)
+}
+
+// idempotencyPoll 幂等键被其他节点占用时检查结果的间隔
+var idempotencyPoll = 50 * time.Millisecond
+
+// NewIdempotency 创建幂等去重器，默认不启用
+func NewIdempotency() *Idempotency {
+	return &Idempotency{window: time.Minute}
+}
+
+// Idempotency 幂等去重
+// 请求 metadata 携带 cosrpc.MetaDataIdempotency 时，缓存已完成请求的响应，
+// 窗口期内相同幂等键的请求(例如 Failover 重试)直接返回缓存结果而不再执行业务方法，
+// 正在执行的请求通过 IdempotencyStore.Claim 占用幂等键，其他请求等待其完成
+type Idempotency struct {
+	store   IdempotencyStore
+	window  time.Duration
+	mutex   sync.RWMutex
+	pending sync.Map //本节点正在执行的幂等键
+}
+
+type idempotencyCall struct {
+	done chan struct{}
+}
+
+// IdempotencyResult 缓存的请求结果，以 JSON 编码后写入 IdempotencyStore
+type IdempotencyResult struct {
+	Code     int32             `json:"code"`     // 业务返回的错误码，用于调用指标
+	Data     []byte            `json:"data"`     // 序列化后未压缩的响应，命中时按本次请求的 MetaDataAcceptCompress 压缩
+	Metadata map[string]string `json:"metadata"` // 业务方法设置的响应 metadata，不包含压缩标记
+}
+
+// Set 设置结果存储和缓存窗口，store 为 nil 时停用
+func (this *Idempotency) Set(store IdempotencyStore, window time.Duration) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.store = store
+	if window > 0 {
+		this.window = window
+	}
+}
+
+func (this *Idempotency) get() (IdempotencyStore, time.Duration) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.store, this.window
+}
+
+// Key 请求的幂等键，未启用或者请求未携带时返回空
+// 幂等键按服务路径和方法隔离，格式为 /servicePath/serviceMethod/key
+func (this *Idempotency) Key(c *cosrpc.Context) string {
+	if store, _ := this.get(); store == nil {
+		return ""
+	}
+	key := c.GetMetadata(cosrpc.MetaDataIdempotency)
+	if key == "" {
+		return ""
+	}
+	return registry.Join(c.ServicePath(), c.ServiceMethod(), key)
+}
+
+// Do 执行 f 并缓存成功的结果，已有结果时直接返回并将缓存的响应 metadata 写入 c
+// 本节点上相同幂等键的并发请求等待第一个请求完成；其他节点正在执行时每隔 idempotencyPoll 检查一次结果，
+// 执行失败时释放幂等键，由等待者重新执行
+func (this *Idempotency) Do(c *cosrpc.Context, key string, f func() (*IdempotencyResult, error)) (*IdempotencyResult, error) {
+	store, window := this.get()
+	if store == nil {
+		return f()
+	}
+	for {
+		if r := this.load(c, store, key); r != nil {
+			return r, nil
+		}
+		call := &idempotencyCall{done: make(chan struct{})}
+		if v, loaded := this.pending.LoadOrStore(key, call); loaded {
+			select {
+			case <-v.(*idempotencyCall).done:
+				continue
+			case <-c.Context().Done():
+				return nil, c.Context().Err()
+			}
+		}
+		return this.call(c, store, window, key, call, f)
+	}
+}
+
+func (this *Idempotency) call(c *cosrpc.Context, store IdempotencyStore, window time.Duration, key string, call *idempotencyCall, f func() (*IdempotencyResult, error)) (*IdempotencyResult, error) {
+	defer func() {
+		this.pending.Delete(key)
+		close(call.done)
+	}()
+	for !store.Claim(key, window) {
+		select {
+		case <-time.After(idempotencyPoll):
+		case <-c.Context().Done():
+			return nil, c.Context().Err()
+		}
+		if r := this.load(c, store, key); r != nil {
+			return r, nil
+		}
+	}
+	defer store.Release(key)
+	r, err := f()
+	if err != nil {
+		return nil, err
+	}
+	if data, e := json.Marshal(r); e != nil {
+		logger.Alert("idempotency marshal error:%v", e)
+	} else {
+		store.Set(key, data, window)
+	}
+	return r, nil
+}
+
+// load 读取缓存的结果并将响应 metadata 写入 c，无法解析时视为未命中
+func (this *Idempotency) load(c *cosrpc.Context, store IdempotencyStore, key string) *IdempotencyResult {
+	data, ok := store.Get(key)
+	if !ok {
+		return nil
+	}
+	r := &IdempotencyResult{}
+	if err := json.Unmarshal(data, r); err != nil {
+		logger.Alert("idempotency unmarshal error:%v", err)
+		return nil
+	}
+	for k, v := range r.Metadata {
+		c.SetMetadata(k, v)
+	}
+	return r
+}
+
+// NewIdempotencyMemory 创建进程内的幂等结果存储，同一节点上的并发请求已经由 Idempotency 合并，Claim 总是成功
+func NewIdempotencyMemory() IdempotencyStore {
+	return &idempotencyMemory{dict: map[string]*idempotencyItem{}}
+}
+
+type idempotencyMemory struct {
+	dict  map[string]*idempotencyItem
+	sweep time.Time
+	mutex sync.Mutex
+}
+
+type idempotencyItem struct {
+	data    []byte
+	expired time.Time
+}
+
+func (this *idempotencyMemory) Get(key string) ([]byte, bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	item, ok := this.dict[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(item.expired) {
+		delete(this.dict, key)
+		return nil, false
+	}
+	return item.data, true
+}
+
+// Set 写入结果，每个缓存窗口清理一次过期数据
+func (this *idempotencyMemory) Set(key string, data []byte, ttl time.Duration) {
+	now := time.Now()
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if now.After(this.sweep) {
+		for k, v := range this.dict {
+			if now.After(v.expired) {
+				delete(this.dict, k)
+			}
+		}
+		this.sweep = now.Add(ttl)
+	}
+	this.dict[key] = &idempotencyItem{data: data, expired: now.Add(ttl)}
+}
+
+func (this *idempotencyMemory) Claim(string, time.Duration) bool {
+	return true
+}
+
+func (this *idempotencyMemory) Release(string) {}
@@ -0,0 +1,149 @@
+package server_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/cosrpc/cosrpctest"
+	"github.com/hwcer/cosrpc/server"
+	"github.com/smallnest/rpcx/share"
+)
+
+type orderReply struct {
+	Order int32 `json:"order"`
+}
+
+// newOrderServer 启动服务 order，/create 每次执行生成新的订单号，并在响应 metadata 中返回
+func newOrderServer(t *testing.T, store server.IdempotencyStore, seq *int32, wait chan struct{}) *cosrpctest.Server {
+	ts := cosrpctest.New(t)
+	ts.Idempotency.Set(store, time.Minute)
+	create := func(c *cosrpc.Context) any {
+		if wait != nil {
+			<-wait
+		}
+		n := atomic.AddInt32(seq, 1)
+		c.SetMetadata("order", "created")
+		return &orderReply{Order: n}
+	}
+	if err := ts.Service("order").Register(create, "/create"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func invokeOrder(ts *cosrpctest.Server, key string) (*orderReply, map[string]string, error) {
+	res := map[string]string{}
+	ctx := context.WithValue(ts.Client.Idempotent(context.Background(), key), share.ResMetaDataKey, res)
+	reply, err := cosrpctest.Invoke[orderReply](ctx, ts, "order", "/create", nil)
+	return reply, res, err
+}
+
+func TestIdempotency(t *testing.T) {
+	var seq int32
+	ts := newOrderServer(t, server.NewIdempotencyMemory(), &seq, nil)
+	first, _, err := invokeOrder(ts, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay, res, err := invokeOrder(ts, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.Order != first.Order || seq != 1 {
+		t.Errorf("replay = %v, executions = %v, want the cached order %v", replay.Order, seq, first.Order)
+	}
+	if res["order"] != "created" {
+		t.Errorf("response metadata = %v, want the cached metadata", res)
+	}
+	if other, _, err := invokeOrder(ts, "k2"); err != nil || other.Order == first.Order {
+		t.Errorf("another key: reply = %v, err = %v, want a new order", other, err)
+	}
+}
+
+// sharedStore 多节点共享的幂等存储，Claim 在 Release 之前只成功一次，成功时写入 claims
+type sharedStore struct {
+	dict    sync.Map
+	mutex   sync.Mutex
+	claimed map[string]bool
+	claims  chan string
+}
+
+func (s *sharedStore) Get(key string) ([]byte, bool) {
+	v, ok := s.dict.Load(key)
+	if !ok {
+		return nil, false
+	}
+	return v.([]byte), true
+}
+
+func (s *sharedStore) Set(key string, data []byte, _ time.Duration) {
+	s.dict.Store(key, data)
+}
+
+func (s *sharedStore) Claim(key string, _ time.Duration) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.claimed[key] {
+		return false
+	}
+	s.claimed[key] = true
+	s.claims <- key
+	return true
+}
+
+func (s *sharedStore) Release(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.claimed, key)
+}
+
+// 模拟 Failover 重试到其他节点：节点 B 等待节点 A 执行完成后返回 A 的结果，不再执行业务方法
+func TestIdempotencyShared(t *testing.T) {
+	store := &sharedStore{claimed: map[string]bool{}, claims: make(chan string, 10)}
+	var seqA, seqB int32
+	wait := make(chan struct{})
+	a := newOrderServer(t, store, &seqA, wait)
+	b := newOrderServer(t, store, &seqB, nil)
+
+	type result struct {
+		reply *orderReply
+		res   map[string]string
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		reply, res, err := invokeOrder(a, "k")
+		done <- result{reply, res, err}
+	}()
+	// 等待节点 A 占用幂等键
+	select {
+	case <-store.claims:
+	case <-time.After(2 * time.Second):
+		t.Fatal("node A did not claim the key")
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(wait)
+	}()
+	replyB, resB, err := invokeOrder(b, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra := <-done
+	if ra.err != nil {
+		t.Fatal(ra.err)
+	}
+	if seqA != 1 || seqB != 0 {
+		t.Errorf("executions A = %v, B = %v, want only node A", seqA, seqB)
+	}
+	if replyB.Order != ra.reply.Order || resB["order"] != "created" {
+		t.Errorf("node B reply = %v %v, want node A result %v", replyB.Order, resB, ra.reply.Order)
+	}
+}
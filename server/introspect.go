@@ -0,0 +1,77 @@
+package server
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hwcer/cosgo/registry"
+	"github.com/hwcer/cosrpc"
+)
+
+// IntrospectionService 内置健康检查与自省服务的服务路径
+const IntrospectionService = "_cosrpc"
+
+// IntrospectionInfo 节点运行信息
+type IntrospectionInfo struct {
+	Module    string `json:"module"`    //主模块路径
+	Version   string `json:"version"`   //主模块版本
+	GoVersion string `json:"goVersion"` //编译使用的 Go 版本
+	Started   int64  `json:"started"`   //启动时间(unix 秒)
+	Uptime    int64  `json:"uptime"`    //运行时长(秒)
+	Inflight  int64  `json:"inflight"`  //正在处理的请求数量
+}
+
+// introspect 注册内置服务 _cosrpc，只注册一次，Close 之后再次启动时不重复注册
+//
+//	/ping      返回当前 unix 时间
+//	/services  返回已注册且未注销的服务路径及其方法
+//	/info      返回版本、运行时长和正在处理的请求数量
+func (xs *Server) introspect() (err error) {
+	if !atomic.CompareAndSwapInt32(&xs.introspected, 0, 1) {
+		return
+	}
+	service := xs.Service(IntrospectionService)
+	if err = service.Register(xs.introspectPing, "/ping"); err != nil {
+		return
+	}
+	if err = service.Register(xs.introspectServices, "/services"); err != nil {
+		return
+	}
+	return service.Register(xs.introspectInfo, "/info")
+}
+
+func (xs *Server) introspectPing(c *cosrpc.Context) interface{} {
+	return time.Now().Unix()
+}
+
+func (xs *Server) introspectServices(c *cosrpc.Context) interface{} {
+	services := map[string][]string{}
+	xs.Registry.Nodes(func(node *registry.Node) bool {
+		servicePath, serviceMethod := xs.parseServiceName(node.Name())
+		if _, removed := xs.removed.Load(servicePath); !removed && servicePath != IntrospectionService {
+			services[servicePath] = append(services[servicePath], serviceMethod)
+		}
+		return true
+	})
+	for _, methods := range services {
+		sort.Strings(methods)
+	}
+	return services
+}
+
+func (xs *Server) introspectInfo(c *cosrpc.Context) interface{} {
+	info := &IntrospectionInfo{GoVersion: runtime.Version(), Inflight: xs.Inflight()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Module = bi.Main.Path
+		info.Version = strings.TrimPrefix(bi.Main.Version, "v")
+	}
+	if !xs.startTime.IsZero() {
+		info.Started = xs.startTime.Unix()
+		info.Uptime = int64(time.Since(xs.startTime).Seconds())
+	}
+	return info
+}
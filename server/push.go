@@ -0,0 +1,28 @@
+package server
+
+import (
+	"errors"
+	"net"
+
+	"github.com/hwcer/cosgo/binder"
+)
+
+// ErrPushUnsupported 连接不存在，in-process 调用无法推送消息
+var ErrPushUnsupported = errors.New("push unsupported without connection")
+
+// Push 向双向通信客户端推送消息
+// conn 在处理器中通过 cosrpc.Context.Conn() 获取，可以保存下来在请求结束后继续推送
+// args 为 []byte 时直接发送，否则按 meta 中的 Content-Type 序列化
+// 客户端通过 client.Subscribe 接收
+func (xs *Server) Push(conn net.Conn, servicePath, serviceMethod string, meta map[string]string, args any) (err error) {
+	if conn == nil {
+		return ErrPushUnsupported
+	}
+	var data []byte
+	if v, ok := args.([]byte); ok {
+		data = v
+	} else if data, err = binder.GetBinder(meta, binder.HeaderContentType).Marshal(args); err != nil {
+		return
+	}
+	return xs.Server.SendMessage(conn, servicePath, serviceMethod, meta, data)
+}
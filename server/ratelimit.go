@@ -0,0 +1,150 @@
+package server
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hwcer/cosgo"
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/cosrpc"
+)
+
+// ErrRateLimit 请求被限流
+var ErrRateLimit = values.Errorf(cosrpc.ErrCodeRateLimit, "rate limit")
+
+// rateLimitMaxBuckets 单条规则最多保留的令牌桶数量，超出时清理已回满的桶
+const rateLimitMaxBuckets = 10000
+
+// RateLimitRule 限流规则
+//
+//	rpcx:
+//	  ratelimit:
+//	    - {name: "user/login", key: "uid", rate: 5, burst: 10}
+type RateLimitRule struct {
+	Name  string  `json:"name"`  //服务路径(user)或服务路径加方法(user/login)，为空时对所有请求生效
+	Key   string  `json:"key"`   //按请求 metadata 字段分桶，为空时共用一个令牌桶
+	Rate  float64 `json:"rate"`  //每秒生成的令牌数
+	Burst int     `json:"burst"` //令牌桶容量，默认等于 Rate
+}
+
+// NewRateLimiter 创建限流器
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{}
+}
+
+// RateLimiter 基于令牌桶的限流器
+// 规则可以按服务、方法或者请求 metadata 中的任意字段(调用方服务、用户ID、服务器ID)分桶
+type RateLimiter struct {
+	rules map[string][]*rateLimit
+	mutex sync.RWMutex
+}
+
+type rateLimit struct {
+	rule    RateLimitRule
+	burst   float64
+	buckets map[string]*tokenBucket
+	mutex   sync.Mutex
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (r *rateLimit) refill(b *tokenBucket, now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * r.rule.Rate
+	if b.tokens > r.burst {
+		b.tokens = r.burst
+	}
+	b.last = now
+}
+
+func (r *rateLimit) allow(key string, now time.Time) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	b := r.buckets[key]
+	if b == nil {
+		if len(r.buckets) >= rateLimitMaxBuckets {
+			r.sweep(now)
+		}
+		b = &tokenBucket{tokens: r.burst, last: now}
+		r.buckets[key] = b
+	} else {
+		r.refill(b, now)
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens -= 1
+	return true
+}
+
+// sweep 清理已经回满的令牌桶，回满的桶与新建的桶等价
+func (r *rateLimit) sweep(now time.Time) {
+	for k, b := range r.buckets {
+		if r.refill(b, now); b.tokens >= r.burst {
+			delete(r.buckets, k)
+		}
+	}
+}
+
+// Set 替换全部限流规则，Rate <= 0 的规则被忽略
+func (this *RateLimiter) Set(rules ...RateLimitRule) {
+	dict := map[string][]*rateLimit{}
+	for _, rule := range rules {
+		if rule.Rate <= 0 {
+			continue
+		}
+		rule.Name = strings.Trim(rule.Name, "/")
+		r := &rateLimit{rule: rule, burst: float64(rule.Burst), buckets: map[string]*tokenBucket{}}
+		if r.burst <= 0 {
+			r.burst = rule.Rate
+		}
+		if r.burst < 1 {
+			r.burst = 1
+		}
+		dict[rule.Name] = append(dict[rule.Name], r)
+	}
+	this.mutex.Lock()
+	this.rules = dict
+	this.mutex.Unlock()
+}
+
+// Reload 从 cosgo 配置 rpcx.ratelimit 中加载限流规则
+func (this *RateLimiter) Reload() error {
+	cfg := struct {
+		Rpcx struct {
+			RateLimit []RateLimitRule `json:"ratelimit"`
+		} `json:"rpcx"`
+	}{}
+	if err := cosgo.Config.Unmarshal(&cfg); err != nil {
+		return err
+	}
+	this.Set(cfg.Rpcx.RateLimit...)
+	return nil
+}
+
+// Allow 检查请求是否被允许，全局、服务和方法上的规则全部通过才放行
+func (this *RateLimiter) Allow(c *cosrpc.Context) bool {
+	this.mutex.RLock()
+	rules := this.rules
+	this.mutex.RUnlock()
+	if len(rules) == 0 {
+		return true
+	}
+	now := time.Now()
+	servicePath := c.ServicePath()
+	for _, name := range []string{"", servicePath, servicePath + c.ServiceMethod()} {
+		for _, r := range rules[name] {
+			var key string
+			if r.rule.Key != "" {
+				key = c.GetMetadata(r.rule.Key)
+			}
+			if !r.allow(key, now) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/cosrpc/client"
+	"github.com/hwcer/cosrpc/cosrpctest"
+	"github.com/hwcer/cosrpc/server"
+	"github.com/smallnest/rpcx/share"
+)
+
+func TestRateLimit(t *testing.T) {
+	ts := cosrpctest.New(t)
+	if err := ts.Service("echo").Register(hello, "/hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ts.RateLimit.Set(server.RateLimitRule{Name: "echo", Rate: 0.001, Burst: 1})
+	if _, err := cosrpctest.Invoke[echoReply](context.Background(), ts, "echo", "/hello", nil); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	_, err := cosrpctest.Invoke[echoReply](context.Background(), ts, "echo", "/hello", nil)
+	var limited *client.RateLimitError
+	if !errors.As(err, &limited) {
+		t.Fatalf("err = %v, want *client.RateLimitError", err)
+	}
+	var e *cosrpc.Error
+	if !errors.As(err, &e) || e.Code != cosrpc.ErrCodeRateLimit {
+		t.Errorf("err = %v, want ErrCodeRateLimit", err)
+	}
+	if n := len(ts.Calls()); n != 1 {
+		t.Errorf("calls = %v, rejected requests must not reach the handler", n)
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	ts := cosrpctest.New(t)
+	if err := ts.Service("echo").Register(hello, "/hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ts.RateLimit.Set(server.RateLimitRule{Name: "echo/hello", Key: "uid", Rate: 0.001, Burst: 1})
+	invoke := func(uid string) error {
+		ctx := context.WithValue(context.Background(), share.ReqMetaDataKey, map[string]string{"uid": uid})
+		_, err := cosrpctest.Invoke[echoReply](ctx, ts, "echo", "/hello", nil)
+		return err
+	}
+	if err := invoke("1"); err != nil {
+		t.Fatalf("uid 1: %v", err)
+	}
+	if err := invoke("2"); err != nil {
+		t.Fatalf("uid 2 uses its own bucket: %v", err)
+	}
+	var limited *client.RateLimitError
+	if err := invoke("1"); !errors.As(err, &limited) {
+		t.Errorf("uid 1 again: err = %v, want *client.RateLimitError", err)
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/hwcer/cosgo/registry"
+	"github.com/smallnest/rpcx/protocol"
+	"github.com/smallnest/rpcx/server"
+	"github.com/smallnest/rpcx/share"
+)
+
+// rpcx 路由表中唯一的路由，所有请求由 router 转发到该路由
+const (
+	routeServicePath   = "_cosrpc_route"
+	routeServiceMethod = "dispatch"
+)
+
+var routeContextKey = &struct{ name string }{name: "route"}
+
+// router 服务路由
+// rpcx 的路由表没有加锁，运行中通过 UpdateHandler 修改会与正在处理的请求产生数据竞争，也无法删除路由，
+// 因此 rpcx 只注册一个固定的路由，在 PreHandleRequest 中按 cosrpc 自己的路由表查找节点并改写到该路由，
+// 运行时发布和注销服务只修改 cosrpc 的路由表
+type router struct {
+	routes sync.Map //servicePath.serviceMethod => *registry.Node
+	mutex  sync.Mutex
+}
+
+type route struct {
+	req           *protocol.Message
+	node          *registry.Node
+	servicePath   string
+	serviceMethod string
+}
+
+func routeKey(servicePath, serviceMethod string) string {
+	return servicePath + "." + serviceMethod
+}
+
+// PreHandleRequest 实现 rpcx PreHandleRequestPlugin
+// 记录原始的服务路径和节点后改写到 rpcx 中注册的固定路由，节点不存在时由 dispatch 返回 ErrServiceNotFound
+func (r *router) PreHandleRequest(ctx context.Context, req *protocol.Message) error {
+	sc, ok := ctx.(*share.Context)
+	if !ok {
+		return nil
+	}
+	v := &route{req: req, servicePath: req.ServicePath, serviceMethod: req.ServiceMethod}
+	if node, ok := r.routes.Load(routeKey(req.ServicePath, req.ServiceMethod)); ok {
+		v.node = node.(*registry.Node)
+	}
+	share.WithLocalValue(sc, routeContextKey, v)
+	req.ServicePath, req.ServiceMethod = routeServicePath, routeServiceMethod
+	return nil
+}
+
+// add 添加路由，name 为空时添加所有未注销的服务
+func (r *router) add(xs *Server, name string) {
+	xs.Registry.Nodes(func(node *registry.Node) bool {
+		servicePath, serviceMethod := xs.parseServiceName(node.Name())
+		if _, removed := xs.removed.Load(servicePath); removed {
+			return true
+		}
+		if name == "" || servicePath == name {
+			r.routes.Store(routeKey(servicePath, serviceMethod), node)
+		}
+		return true
+	})
+}
+
+// remove 删除服务的所有路由
+func (r *router) remove(name string) {
+	prefix := routeKey(name, "")
+	r.routes.Range(func(k, _ any) bool {
+		if strings.HasPrefix(k.(string), prefix) {
+			r.routes.Delete(k)
+		}
+		return true
+	})
+}
+
+// dispatch rpcx 固定路由的处理器，恢复原始的服务路径后调用 Caller
+func (xs *Server) dispatch(c *server.Context) error {
+	v, ok := c.Get(routeContextKey).(*route)
+	if !ok {
+		return failure(c, ErrServiceNotFound)
+	}
+	v.req.ServicePath, v.req.ServiceMethod = v.servicePath, v.serviceMethod
+	return xs.Caller(c, v.node)
+}
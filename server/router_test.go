@@ -0,0 +1,92 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/cosrpc/cosrpctest"
+)
+
+func TestPublishUnregister(t *testing.T) {
+	ts := cosrpctest.New(t)
+	if err := ts.Service("echo").Register(hello, "/hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// 启动之后创建的服务在 Publish 之前不可调用
+	if err := ts.Service("plugin").Register(hello, "/hello"); err != nil {
+		t.Fatal(err)
+	}
+	invoke := func() error {
+		_, err := cosrpctest.Invoke[echoReply](context.Background(), ts, "plugin", "/hello", nil)
+		return err
+	}
+	notFound := func(step string) {
+		t.Helper()
+		var e *cosrpc.Error
+		if err := invoke(); !errors.As(err, &e) || e.Code != cosrpc.ErrCodeServiceNotFound {
+			t.Errorf("%v: err = %v, want ErrCodeServiceNotFound", step, err)
+		}
+	}
+	found := func(step string) {
+		t.Helper()
+		if err := invoke(); err != nil {
+			t.Errorf("%v: %v", step, err)
+		}
+	}
+	notFound("before publish")
+	if err := ts.Publish("plugin"); err != nil {
+		t.Fatal(err)
+	}
+	found("published")
+	if err := ts.Unregister("plugin"); err != nil {
+		t.Fatal(err)
+	}
+	notFound("unregistered")
+	if _, err := cosrpctest.Invoke[echoReply](context.Background(), ts, "echo", "/hello", nil); err != nil {
+		t.Errorf("other services are not affected: %v", err)
+	}
+	if err := ts.Publish("plugin"); err != nil {
+		t.Fatal(err)
+	}
+	found("published again")
+}
+
+// 请求与 Publish、Unregister 并发时路由表不发生数据竞争，使用 -race 运行
+func TestPublishUnregisterConcurrent(t *testing.T) {
+	ts := cosrpctest.New(t)
+	if err := ts.Service("plugin").Register(hello, "/hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				_, err := cosrpctest.Invoke[echoReply](context.Background(), ts, "plugin", "/hello", nil)
+				var e *cosrpc.Error
+				if err != nil && (!errors.As(err, &e) || e.Code != cosrpc.ErrCodeServiceNotFound) {
+					t.Errorf("err = %v, want nil or ErrCodeServiceNotFound", err)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		if err := ts.Unregister("plugin"); err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.Publish("plugin"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
@@ -1,21 +1,34 @@
 package server
 
 import (
+	"context"
 	"errors"
+	"net"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/hwcer/cosgo/registry"
 	"github.com/hwcer/cosgo/scc"
+	"github.com/hwcer/cosgo/utils"
+	"github.com/hwcer/cosgo/values"
 	"github.com/hwcer/cosrpc"
 	"github.com/hwcer/logger"
+	"github.com/smallnest/rpcx/protocol"
 	"github.com/smallnest/rpcx/server"
+	"github.com/smallnest/rpcx/share"
 )
 
 // RegistryMethod 定义服务注册的方法名
 const RegistryMethod = "RPCX"
 
+// ErrServerClosing 服务器正在关闭，拒绝新的请求
+var ErrServerClosing = values.Errorf(cosrpc.ErrCodeServerClosing, "server closing")
+
+// ErrServiceNotFound 服务不存在或已经注销
+var ErrServiceNotFound = values.Errorf(cosrpc.ErrCodeServiceNotFound, "service not found")
+
 // Caller 定义服务调用接口
 // 用于处理 RPC 请求并返回结果
 type Caller interface {
@@ -30,13 +43,39 @@ type Register interface {
 	Register(name string, rcvr interface{}, metadata string) (err error)
 }
 
+// RegisterRemover 支持注销单个服务的注册器
+// 运行时注销服务(Server.Unregister)时用于更新注册中心
+type RegisterRemover interface {
+	Unregister(name string) (err error)
+}
+
+// Options 服务器配置
+// 零值字段使用 cosrpc 全局配置，同一进程可以用不同的 Options 创建多个互相独立的 Server
+type Options struct {
+	Network    string                            // 网络类型，默认 cosrpc.Config.Network
+	Address    string                            // 监听地址，默认 cosrpc.Config.Address
+	Appid      string                            // 注册中心命名空间，由 Register 使用
+	TLS        *cosrpc.TLSOptions                // TLS 配置，默认 cosrpc.Config.TLS
+	MaxPayload int                               // 请求体最大长度，默认 cosrpc.Config.MaxPayload，cosrpc.Config.MaxPayloads 中的服务配置优先
+	Register   func(s *Server) (Register, error) // 服务注册器，未设置且使用全局地址时使用 SetRegister 设置的注册器
+}
+
 // New 创建并返回一个新的 Server 实例
 // 初始化内部的 rpcx Server 和服务注册表
-func New() *Server {
+func New(opts ...Options) *Server {
 	r := &Server{}
+	if len(opts) > 0 {
+		r.Options = opts[0]
+	}
 	r.Server = server.NewServer()
 	r.Registry = registry.New()
+	r.Bulkhead = NewBulkhead()
+	r.RateLimit = NewRateLimiter()
+	r.Idempotency = NewIdempotency()
 	r.Server.DisableHTTPGateway = true
+	r.Server.AddHandler(routeServicePath, routeServiceMethod, r.dispatch)
+	r.Server.Plugins.Add(&r.sessions)
+	r.Server.Plugins.Add(&r.router)
 	return r
 }
 
@@ -45,37 +84,199 @@ func New() *Server {
 type Server struct {
 	*server.Server                    // 内嵌的 rpcx Server
 	started        int32              // 服务器启动状态，0 未启动，1 已启动
+	deferred       int32              // 调用 Start 时没有任何服务，1 时由第一次 Publish 启动
+	introspected   int32              // 内置服务 _cosrpc 已经注册
+	closing        int32              // 服务器关闭状态，1 时拒绝新的请求
+	inflight       int64              // 正在处理的请求数量
 	register       Register           // 服务注册器
 	Registry       *registry.Registry // 服务注册表
+	Options        Options            // 服务器配置
+	address        *utils.Address     // 监听地址
+	Bulkhead       *Bulkhead          // 服务并发限制
+	RateLimit      *RateLimiter       // 服务限流
+	Idempotency    *Idempotency       // 幂等去重，默认不启用
+	Introspection  bool               // 启动时注册内置服务 _cosrpc(ping、服务列表、运行信息)
+	startTime      time.Time          // 启动时间
+	removed        sync.Map           // 已注销的服务路径
+	router         router             // 服务路由
+	sessions       sessions           // 连接会话
+	Authenticator  Authenticator      // 服务间认证，默认使用 TokenAuthenticator
 }
 
 // Caller 处理 RPC 请求的入口方法
 // 1. 从 node 中获取 Handler
-// 2. 创建 cosrpc Context
-// 3. 调用 Handler.Caller 处理请求
-// 4. 序列化响应并写入客户端
+// 2. 创建 cosrpc Context，提取 trace context 并创建服务端 span
+// 3. 检查请求体长度，超过限制时返回 cosrpc.ErrPayloadTooLarge
+// 4. 认证请求，失败时返回 ErrUnauthorized
+// 5. 检查限流规则，被限流时返回 ErrRateLimit
+// 6. 获取并发许可，达到上限时返回 ErrServiceBusy 错误，排队时调用方已经超时返回 ErrDeadline
+// 7. 调用 Handler.Invoke 执行拦截器链、Caller 和 Serialize，携带幂等键时复用已完成请求的结果
+// 8. 写入响应，认证失败、限流和并发达到上限以错误返回
+// 9. 记录调用指标，参见 cosrpc.Metrics；超过阈值时记录慢调用日志，参见 cosrpc.Slowlog
 func (xs *Server) Caller(sc cosrpc.IContext, node *registry.Node) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			logger.Alert("rpcx server recover error:%v", r)
+			err = failure(sc, values.Errorf(cosrpc.ErrCodeInternal, "server recover error"))
 		}
 	}()
+	defer func() {
+		if err != nil {
+			err = failure(sc, err)
+		}
+	}()
+	start := time.Now()
+	metric := &cosrpc.Metric{Side: cosrpc.MetricSideServer, ServicePath: sc.ServicePath(), ServiceMethod: sc.ServiceMethod(), RequestSize: len(sc.Payload())}
+	defer func() {
+		metric.Latency = time.Since(start)
+		if err != nil {
+			metric.Code = cosrpc.AsError(err).Code
+		}
+		cosrpc.Observe(metric)
+		cosrpc.Slowlog(metric, sc.Metadata(), remoteAddr(sc))
+	}()
+
+	// 先计数再检查关闭状态，保证 Close 等待时不会漏掉已进入的请求
+	atomic.AddInt64(&xs.inflight, 1)
+	defer atomic.AddInt64(&xs.inflight, -1)
+	if atomic.LoadInt32(&xs.closing) == 1 {
+		return ErrServerClosing
+	}
+	if _, removed := xs.removed.Load(sc.ServicePath()); node == nil || removed {
+		metric.ServicePath, metric.ServiceMethod = cosrpc.MetricUnknown, cosrpc.MetricUnknown
+		return ErrServiceNotFound
+	}
 
 	handler, ok := node.Handler().(*Handler)
 	if !ok {
 		return errors.New("handler unknown")
 	}
 	c := cosrpc.NewContext(sc)
-	var reply any
-	reply, err = handler.Caller(node, c)
+	defer c.Release()
+	span := c.StartSpan()
+	defer func() {
+		span.Finish(err)
+	}()
+	if session := xs.Session(c.Conn()); session != nil {
+		c.SetValue(cosrpc.SessionContextKey, session)
+	}
+	if err = c.LimitPayload(xs.maxPayload(c.ServicePath())); err != nil {
+		return
+	}
+	if !xs.authenticate(c) {
+		return ErrUnauthorized
+	}
+	// 限流和并发达到上限以 rpcx 错误返回，Failover 模式可以换节点重试
+	if !xs.RateLimit.Allow(c) {
+		return ErrRateLimit
+	}
+	release, ok := xs.Bulkhead.Acquire(c.Context(), c.ServicePath(), c.ServiceMethod())
+	if !ok {
+		if c.Context().Err() != nil {
+			return ErrDeadline
+		}
+		return ErrServiceBusy
+	}
+	defer release()
+	reply, data, err := xs.invoke(handler, node, c)
 	if err != nil {
 		return
 	}
-	var data []byte
-	if data, err = handler.Marshal(c, reply); err == nil {
-		return c.Write(data)
+	switch v := reply.(type) {
+	case *values.Message:
+		metric.Code = v.Code
+	case *IdempotencyResult:
+		metric.Code = v.Code
 	}
-	return
+	if data, err = handler.compress(c, data); err != nil {
+		return
+	}
+	metric.ResponseSize = len(data)
+	return c.Write(data)
+}
+
+// invoke 执行业务方法，返回未压缩的响应
+// 请求携带幂等键时缓存序列化后的结果、错误码和响应 metadata，重试请求直接返回缓存
+func (xs *Server) invoke(handler *Handler, node *registry.Node, c *cosrpc.Context) (any, []byte, error) {
+	key := xs.Idempotency.Key(c)
+	if key == "" {
+		return handler.Invoke(node, c)
+	}
+	r, err := xs.Idempotency.Do(c, key, func() (*IdempotencyResult, error) {
+		reply, data, err := handler.Invoke(node, c)
+		if err != nil {
+			return nil, err
+		}
+		r := &IdempotencyResult{Data: data}
+		if msg, ok := reply.(*values.Message); ok {
+			r.Code = msg.Code
+		}
+		if meta, _ := c.GetValue(share.ResMetaDataKey).(map[string]string); len(meta) > 0 {
+			r.Metadata = make(map[string]string, len(meta))
+			for k, v := range meta {
+				r.Metadata[k] = v
+			}
+		}
+		return r, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, r.Data, nil
+}
+
+// maxPayload 服务的请求体最大长度
+func (xs *Server) maxPayload(servicePath string) int {
+	if v, ok := cosrpc.Config.MaxPayloads[servicePath]; ok {
+		return v
+	}
+	if xs.Options.MaxPayload > 0 {
+		return xs.Options.MaxPayload
+	}
+	return cosrpc.Config.MaxPayload
+}
+
+// messageOverhead 消息中服务路径、方法和 metadata 预留的长度
+const messageOverhead = 64 << 10
+
+// limitMessage 按最大的请求体限制设置 rpcx protocol.MaxMessageLength
+// rpcx 读取消息头后发现长度超过限制时直接返回错误，不会将整个消息读入内存；按服务的解压后长度限制由 Context.LimitPayload 检查
+// 存在不限制的服务时不设置；protocol.MaxMessageLength 是进程级的设置，已经设置时只会调大，同一进程中客户端读取响应时同样受该限制
+func (xs *Server) limitMessage() {
+	limit := xs.Options.MaxPayload
+	if limit <= 0 {
+		limit = cosrpc.Config.MaxPayload
+	}
+	if limit <= 0 {
+		return
+	}
+	for _, v := range cosrpc.Config.MaxPayloads {
+		if v <= 0 {
+			return
+		}
+		if v > limit {
+			limit = v
+		}
+	}
+	if limit += messageOverhead; protocol.MaxMessageLength == 0 || protocol.MaxMessageLength < limit {
+		protocol.MaxMessageLength = limit
+	}
+}
+
+// remoteAddr 客户端地址，in-process 模式返回空
+func remoteAddr(sc cosrpc.IContext) string {
+	if conn, ok := sc.Get(server.RemoteConnContextKey).(net.Conn); ok {
+		return conn.RemoteAddr().String()
+	}
+	return ""
+}
+
+// failure 将错误转换为 cosrpc.Error 并写入响应 metadata
+// rpcx 在 WriteError 时会将响应 metadata 一并返回，客户端据此还原错误码和详情
+func failure(sc cosrpc.IContext, err error) error {
+	e := cosrpc.AsError(err)
+	cosrpc.NewContext(sc).SetMetadata(cosrpc.MetaDataError, e.Marshal())
+	return e
 }
 
 // Service 创建并返回一个新的服务
@@ -106,30 +307,52 @@ func (xs *Server) startServer(network, address string) (err error) {
 	return
 }
 
+// startTLS 按配置为 rpcx Server 启用 TLS
+func (xs *Server) startTLS() error {
+	opts := xs.Options.TLS
+	if opts == nil {
+		opts = cosrpc.Config.TLS
+	}
+	if opts == nil {
+		return nil
+	}
+	cfg, err := opts.Server()
+	if err != nil {
+		return err
+	}
+	server.WithTLSConfig(cfg)(xs.Server)
+	return nil
+}
+
 // startRegister 启动服务注册
 // 1. 检查默认注册器是否存在
 // 2. 创建注册器实例
 // 3. 收集服务信息
 // 4. 注册服务
-// 5. 启动注册器
+// 5. 启动注册器，没有服务时同样启动，之后 Publish 的服务由注册器定期刷新
 func (xs *Server) startRegister() (err error) {
-	if defaultRegister == nil {
+	factory := xs.Options.Register
+	if factory == nil && defaultRegister != nil && xs.Options.Network == "" && xs.Options.Address == "" {
+		factory = func(*Server) (Register, error) {
+			return defaultRegister()
+		}
+	}
+	if factory == nil {
 		logger.Alert("register is nil,Can only run in standalone mode")
 		return nil
 	}
-	if xs.register, err = defaultRegister(); err != nil {
+	if xs.register, err = factory(xs); err != nil {
 		return err
 	}
 	// 注册服务,实现 rpcxServiceHandlerMetadata 才具有服务发现功能
 	service := map[string]string{}
 	xs.Registry.Range(func(s *registry.Service) bool {
 		name := strings.TrimPrefix(s.Name(), "/")
-		service[name] = Metadata.Get(name)
+		if _, ok := xs.removed.Load(name); !ok {
+			service[name] = Metadata.Get(name)
+		}
 		return true
 	})
-	if len(service) == 0 {
-		return
-	}
 	for name, meta := range service {
 		if err = xs.register.Register(name, nil, meta); err != nil {
 			return err
@@ -152,30 +375,76 @@ func (xs *Server) parseServiceName(name string) (servicePath string, serviceMeth
 	return
 }
 
+// Publish 发布运行时加载的服务
+// 服务器已启动时为服务添加路由并写入注册中心，服务器未启动时由 Start 统一发布；
+// Start 时没有任何服务的服务器在第一次 Publish 时启动
+// 必须在服务的所有方法注册完成后调用
+func (xs *Server) Publish(name string) (err error) {
+	name = strings.Trim(name, "/")
+	xs.router.mutex.Lock()
+	xs.removed.Delete(name)
+	started := atomic.LoadInt32(&xs.started) == 1
+	if started {
+		xs.router.add(xs, name)
+	}
+	xs.router.mutex.Unlock()
+	if !started && atomic.CompareAndSwapInt32(&xs.deferred, 1, 0) {
+		return xs.Start()
+	}
+	if started && xs.register != nil {
+		err = xs.register.Register(name, nil, Metadata.Get(name))
+	}
+	return
+}
+
+// Unregister 注销服务
+// 删除服务的所有路由，之后对该服务的请求(包括 in-process 调用)返回 ErrServiceNotFound
+// 注册器实现了 RegisterRemover 时同时从注册中心移除，可以再次 Publish 恢复
+func (xs *Server) Unregister(name string) (err error) {
+	name = strings.Trim(name, "/")
+	xs.router.mutex.Lock()
+	xs.removed.Store(name, struct{}{})
+	xs.router.remove(name)
+	xs.router.mutex.Unlock()
+	if xs.register == nil {
+		return
+	}
+	if r, ok := xs.register.(RegisterRemover); ok {
+		err = r.Unregister(name)
+	}
+	return
+}
+
 // Start 启动服务器
-// 1. 检查服务注册表是否为空
+// 1. 检查服务注册表是否为空，为空时(例如只托管运行时加载的服务)不监听，由第一次 Publish 启动
 // 2. 原子操作检查并设置启动状态
-// 3. 获取服务器地址
-// 4. 为每个服务节点添加处理器
-// 5. 启动服务器
-// 6. 启动服务注册
+// 3. 按需注册内置服务 _cosrpc
+// 4. 按配置启用 TLS，获取服务器地址
+// 5. 为每个服务节点添加路由
+// 6. 启动服务器
+// 7. 启动服务注册
 func (xs *Server) Start() (err error) {
 	if xs.Registry.Len() == 0 {
+		atomic.StoreInt32(&xs.deferred, 1)
 		return
 	}
 	if !atomic.CompareAndSwapInt32(&xs.started, 0, 1) {
 		return
 	}
-	address := cosrpc.Address()
-	// 启动服务
-	xs.Registry.Nodes(func(node *registry.Node) (r bool) {
-		servicePath, serviceMethod := xs.parseServiceName(node.Name())
-		var handler = func(c *server.Context) error {
-			return xs.Caller(c, node)
+	atomic.StoreInt32(&xs.closing, 0)
+	if xs.Introspection {
+		if err = xs.introspect(); err != nil {
+			return
 		}
-		xs.Server.AddHandler(servicePath, serviceMethod, handler)
-		return true
-	})
+	}
+	xs.startTime = time.Now()
+	xs.limitMessage()
+	if err = xs.startTLS(); err != nil {
+		return
+	}
+	address := xs.Endpoint()
+	// 启动服务
+	xs.routes()
 
 	err = address.Handle(func(network, address string) error {
 		return xs.startServer(network, address)
@@ -191,19 +460,93 @@ func (xs *Server) Start() (err error) {
 	return
 }
 
+// Listen 在调用方创建的 Listener 上启动服务器，不启用 TLS，也不注册到服务发现
+// 用于测试(参见 cosrpctest)或由调用方管理监听，关闭时同样调用 Close
+func (xs *Server) Listen(ln net.Listener) (err error) {
+	if !atomic.CompareAndSwapInt32(&xs.started, 0, 1) {
+		return
+	}
+	atomic.StoreInt32(&xs.closing, 0)
+	if xs.Introspection {
+		if err = xs.introspect(); err != nil {
+			return
+		}
+	}
+	xs.startTime = time.Now()
+	xs.limitMessage()
+	xs.routes()
+	go func() {
+		if e := xs.Server.ServeListener(ln.Addr().Network(), ln); e != nil && atomic.LoadInt32(&xs.closing) == 0 {
+			logger.Alert("rpc server listen error:%v", e)
+		}
+	}()
+	logger.Trace("rpc server started:%v@%v", ln.Addr().Network(), ln.Addr().String())
+	return
+}
+
+// routes 为所有服务节点添加路由
+func (xs *Server) routes() {
+	xs.router.mutex.Lock()
+	defer xs.router.mutex.Unlock()
+	xs.router.add(xs, "")
+}
+
+// Endpoint 服务器监听地址
+// 未配置 Options.Network 和 Options.Address 时使用全局的 cosrpc.Address()
+func (xs *Server) Endpoint() *utils.Address {
+	if xs.Options.Network == "" && xs.Options.Address == "" {
+		return cosrpc.Address()
+	}
+	if xs.address == nil {
+		network, address := xs.Options.Network, xs.Options.Address
+		if network == "" {
+			network = cosrpc.Config.Network
+		}
+		if address == "" {
+			address = cosrpc.Config.Address
+		}
+		xs.address = cosrpc.NewAddress(network, address)
+	}
+	return xs.address
+}
+
+// Inflight 正在处理的请求数量
+func (xs *Server) Inflight() int64 {
+	return atomic.LoadInt64(&xs.inflight)
+}
+
 // Close 关闭服务器
 // 1. 原子操作检查并设置启动状态
-// 2. 关闭 rpcx Server
-// 3. 停止服务注册
+// 2. 从注册中心注销，客户端不再路由到本节点
+// 3. 拒绝新的请求
+// 4. 等待进行中的请求完成，最长等待 cosrpc.DrainTimeout
+// 5. 关闭 rpcx Server
 func (xs *Server) Close() (err error) {
+	atomic.StoreInt32(&xs.deferred, 0)
 	if !atomic.CompareAndSwapInt32(&xs.started, 1, 0) {
 		return
 	}
-	if err = xs.Server.Shutdown(nil); err != nil {
-		return
-	}
 	if xs.register != nil {
-		err = xs.register.Stop()
+		if err = xs.register.Stop(); err != nil {
+			logger.Alert("rpc server register stop error:%v", err)
+		}
+	}
+	atomic.StoreInt32(&xs.closing, 1)
+	xs.drain(cosrpc.DrainTimeout())
+	// rpcx 在仍有未完成的请求时等待 ctx，不能传入 nil
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return xs.Server.Shutdown(ctx)
+}
+
+// drain 等待进行中的请求完成
+func (xs *Server) drain(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for n := xs.Inflight(); n > 0; n = xs.Inflight() {
+		if time.Now().After(deadline) {
+			logger.Alert("rpc server drain timeout,inflight:%v", n)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
-	return
 }
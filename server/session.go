@@ -0,0 +1,92 @@
+package server
+
+import (
+	"net"
+	"sync"
+
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/logger"
+)
+
+// SessionHook 连接生命周期回调
+type SessionHook func(s *cosrpc.Session)
+
+// sessions 管理连接会话
+// 作为 rpcx 插件在连接建立时创建会话，连接关闭时销毁
+type sessions struct {
+	dict       sync.Map
+	mutex      sync.RWMutex
+	connect    []SessionHook
+	disconnect []SessionHook
+}
+
+func (s *sessions) hooks(hooks []SessionHook, session *cosrpc.Session) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("session hook recover error:%v", r)
+		}
+	}()
+	for _, f := range hooks {
+		f(session)
+	}
+}
+
+// HandleConnAccept 连接建立时创建会话
+func (s *sessions) HandleConnAccept(conn net.Conn) (net.Conn, bool) {
+	session := cosrpc.NewSession(conn)
+	s.dict.Store(conn, session)
+	s.mutex.RLock()
+	hooks := s.connect
+	s.mutex.RUnlock()
+	s.hooks(hooks, session)
+	return conn, true
+}
+
+// HandleConnClose 连接关闭时销毁会话
+func (s *sessions) HandleConnClose(conn net.Conn) bool {
+	v, ok := s.dict.LoadAndDelete(conn)
+	if !ok {
+		return true
+	}
+	s.mutex.RLock()
+	hooks := s.disconnect
+	s.mutex.RUnlock()
+	s.hooks(hooks, v.(*cosrpc.Session))
+	return true
+}
+
+func (s *sessions) get(conn net.Conn) *cosrpc.Session {
+	if v, ok := s.dict.Load(conn); ok {
+		return v.(*cosrpc.Session)
+	}
+	return nil
+}
+
+// OnConnect 注册连接建立回调
+func (xs *Server) OnConnect(f SessionHook) {
+	xs.sessions.mutex.Lock()
+	defer xs.sessions.mutex.Unlock()
+	xs.sessions.connect = append(xs.sessions.connect, f)
+}
+
+// OnDisconnect 注册连接关闭回调，回调结束后会话被销毁
+func (xs *Server) OnDisconnect(f SessionHook) {
+	xs.sessions.mutex.Lock()
+	defer xs.sessions.mutex.Unlock()
+	xs.sessions.disconnect = append(xs.sessions.disconnect, f)
+}
+
+// Session 获取连接会话，连接不存在或已经关闭时返回 nil
+func (xs *Server) Session(conn net.Conn) *cosrpc.Session {
+	if conn == nil {
+		return nil
+	}
+	return xs.sessions.get(conn)
+}
+
+// Sessions 遍历所有连接会话，f 返回 false 时停止
+func (xs *Server) Sessions(f func(s *cosrpc.Session) bool) {
+	xs.sessions.dict.Range(func(_, v any) bool {
+		return f(v.(*cosrpc.Session))
+	})
+}
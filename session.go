@@ -0,0 +1,39 @@
+package cosrpc
+
+import (
+	"net"
+	"sync"
+)
+
+// NewSession 创建连接会话
+func NewSession(conn net.Conn) *Session {
+	return &Session{conn: conn}
+}
+
+// Session 连接级别的会话
+// 用于保存认证身份、调用方服务名等连接相关的状态，连接关闭时销毁
+type Session struct {
+	conn net.Conn
+	data sync.Map
+}
+
+// Conn 会话所属的网络连接
+func (s *Session) Conn() net.Conn {
+	return s.conn
+}
+
+// Get 获取会话中的值
+func (s *Session) Get(key any) any {
+	v, _ := s.data.Load(key)
+	return v
+}
+
+// Set 设置会话中的值
+func (s *Session) Set(key, val any) {
+	s.data.Store(key, val)
+}
+
+// Delete 删除会话中的值
+func (s *Session) Delete(key any) {
+	s.data.Delete(key)
+}
@@ -0,0 +1,69 @@
+package cosrpc
+
+import (
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hwcer/logger"
+)
+
+var slowlogLimiter = &slowlogWindow{}
+
+// slowlogWindow 按秒限制慢调用日志数量
+type slowlogWindow struct {
+	second int64
+	count  int
+	mutex  sync.Mutex
+}
+
+func (w *slowlogWindow) allow(limit int) bool {
+	if limit <= 0 {
+		return true
+	}
+	now := time.Now().Unix()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.second != now {
+		w.second = now
+		w.count = 0
+	}
+	if w.count >= limit {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// Slowlog 调用耗时超过 SlowCall 或数据长度超过 SlowPayload 时记录日志
+// 按 SlowSample 采样并受 SlowLimit 限制，peer 为对端地址，未知时传空
+func Slowlog(m *Metric, meta map[string]string, peer string) {
+	var reason []string
+	if Config.SlowCall > 0 && m.Latency >= time.Duration(Config.SlowCall)*time.Millisecond {
+		reason = append(reason, "slow")
+	}
+	if Config.SlowPayload > 0 && (m.RequestSize >= Config.SlowPayload || m.ResponseSize >= Config.SlowPayload) {
+		reason = append(reason, "payload")
+	}
+	if len(reason) == 0 {
+		return
+	}
+	if Config.SlowSample > 0 && Config.SlowSample < 1 && rand.Float64() >= Config.SlowSample {
+		return
+	}
+	if !slowlogLimiter.allow(Config.SlowLimit) {
+		return
+	}
+	b := strings.Builder{}
+	for _, k := range Config.SlowMetadata {
+		if v, ok := meta[k]; ok {
+			b.WriteString(" ")
+			b.WriteString(k)
+			b.WriteString("=")
+			b.WriteString(v)
+		}
+	}
+	logger.Alert("rpc %v call side=%v service=%v method=%v duration=%v payload=%v reply=%v code=%v peer=%v%v",
+		strings.Join(reason, ","), m.Side, m.ServicePath, strings.Trim(m.ServiceMethod, "/"), m.Latency, m.RequestSize, m.ResponseSize, m.Code, peer, b.String())
+}
@@ -0,0 +1,104 @@
+package cosrpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLS 客户端证书校验模式
+const (
+	TLSVerifyNone    = "none"    //不要求客户端证书
+	TLSVerifyRequest = "request" //请求客户端证书但不校验
+	TLSVerifyGiven   = "given"   //客户端提供证书时校验
+	TLSVerifyRequire = "require" //必须提供并校验客户端证书(双向认证)
+)
+
+// TLSOptions TLS 配置，服务端和客户端共用
+type TLSOptions struct {
+	Cert       string `json:"cert"`       //证书文件
+	Key        string `json:"key"`        //私钥文件
+	CA         string `json:"ca"`         //CA 证书文件，服务端用于校验客户端证书，客户端用于校验服务端证书
+	Verify     string `json:"verify"`     //服务端校验客户端证书的模式，配置了 CA 时默认 require，否则默认 none
+	ServerName string `json:"serverName"` //客户端校验服务端证书时使用的主机名
+	Insecure   bool   `json:"insecure"`   //客户端不校验服务端证书，仅用于测试
+}
+
+func (o *TLSOptions) certificates() ([]tls.Certificate, error) {
+	if o.Cert == "" && o.Key == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(o.Cert, o.Key)
+	if err != nil {
+		return nil, err
+	}
+	return []tls.Certificate{cert}, nil
+}
+
+func (o *TLSOptions) pool() (*x509.CertPool, error) {
+	if o.CA == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(o.CA)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("tls ca file invalid:%v", o.CA)
+	}
+	return pool, nil
+}
+
+// Server 生成服务端 tls.Config
+func (o *TLSOptions) Server() (cfg *tls.Config, err error) {
+	cfg = &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.Certificates, err = o.certificates(); err != nil {
+		return nil, err
+	}
+	if len(cfg.Certificates) == 0 {
+		return nil, fmt.Errorf("tls server cert and key required")
+	}
+	if cfg.ClientCAs, err = o.pool(); err != nil {
+		return nil, err
+	}
+	verify := strings.ToLower(o.Verify)
+	if verify == "" && cfg.ClientCAs != nil {
+		verify = TLSVerifyRequire
+	}
+	switch verify {
+	case "", TLSVerifyNone:
+		cfg.ClientAuth = tls.NoClientCert
+	case TLSVerifyRequest:
+		cfg.ClientAuth = tls.RequestClientCert
+	case TLSVerifyGiven:
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case TLSVerifyRequire:
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("tls verify mode unknown:%v", o.Verify)
+	}
+	return cfg, nil
+}
+
+// Client 生成客户端 tls.Config，配置了 Cert 和 Key 时用于双向认证
+func (o *TLSOptions) Client() (cfg *tls.Config, err error) {
+	cfg = &tls.Config{MinVersion: tls.VersionTLS12, ServerName: o.ServerName, InsecureSkipVerify: o.Insecure}
+	if cfg.Certificates, err = o.certificates(); err != nil {
+		return nil, err
+	}
+	if cfg.RootCAs, err = o.pool(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ClientTLSConfig 全局客户端 TLS 配置，未开启时返回 nil
+func ClientTLSConfig() (*tls.Config, error) {
+	if Config.TLS == nil {
+		return nil, nil
+	}
+	return Config.TLS.Client()
+}
@@ -0,0 +1,178 @@
+package cosrpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hwcer/logger"
+)
+
+// MetaDataTraceparent 请求 metadata 中的 W3C trace context
+// 格式: 00-<trace-id>-<parent-id>-<trace-flags>
+const MetaDataTraceparent = "traceparent"
+
+const (
+	SpanKindClient = "client"
+	SpanKindServer = "server"
+)
+
+const traceFlagSampled = "01"
+
+var spanContextKey = &contextKey{name: "span"}
+
+// spanExporter 导出完成的 span，为空时只传递 trace context 不导出
+var spanExporter SpanExporter
+
+// SpanExporter span 导出器
+type SpanExporter interface {
+	Export(span *Span)
+}
+
+// SetSpanExporter 设置 span 导出器，启动前调用
+func SetSpanExporter(e SpanExporter) {
+	spanExporter = e
+}
+
+// Span 一次调用在客户端或服务端的记录
+type Span struct {
+	TraceID  string        `json:"traceId"`
+	SpanID   string        `json:"spanId"`
+	ParentID string        `json:"parentId,omitempty"`
+	Name     string        `json:"name"`
+	Kind     string        `json:"kind"`
+	Flags    string        `json:"-"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// NewSpan 创建 span，parent 为空时开始新的 trace
+func NewSpan(parent *Span, kind, name string) *Span {
+	s := &Span{Kind: kind, Name: name, SpanID: traceRandom(8), Start: time.Now()}
+	if parent != nil {
+		s.TraceID = parent.TraceID
+		s.ParentID = parent.SpanID
+		s.Flags = parent.Flags
+	} else {
+		s.TraceID = traceRandom(16)
+		s.Flags = traceFlagSampled
+	}
+	return s
+}
+
+// ParseTraceparent 解析 traceparent，返回的 span 仅包含 TraceID、SpanID 和 Flags，作为远程父节点使用
+func ParseTraceparent(v string) *Span {
+	arr := strings.Split(v, "-")
+	if len(arr) < 4 || len(arr[0]) != 2 || arr[0] == "ff" {
+		return nil
+	}
+	if !traceValid(arr[1], 32) || !traceValid(arr[2], 16) || !traceValid(arr[3], 2) {
+		return nil
+	}
+	return &Span{TraceID: arr[1], SpanID: arr[2], Flags: arr[3]}
+}
+
+// Traceparent 编码为 traceparent，下游调用以当前 span 为父节点
+func (s *Span) Traceparent() string {
+	return "00-" + s.TraceID + "-" + s.SpanID + "-" + s.Flags
+}
+
+// Sampled 调用链是否被采样，未采样的 span 只传递不导出
+func (s *Span) Sampled() bool {
+	b, err := hex.DecodeString(s.Flags)
+	return err == nil && len(b) == 1 && b[0]&1 == 1
+}
+
+// Finish 结束 span 并导出
+func (s *Span) Finish(err error) {
+	if s == nil || spanExporter == nil || !s.Sampled() {
+		return
+	}
+	s.Duration = time.Since(s.Start)
+	if err != nil {
+		s.Error = err.Error()
+	}
+	spanExporter.Export(s)
+}
+
+// ContextWithSpan 将 span 放入 ctx，使用该 ctx 发起的调用作为其子节点
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey, span)
+}
+
+// SpanFromContext 获取 ctx 中的 span
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	v, _ := ctx.Value(spanContextKey).(*Span)
+	return v
+}
+
+func traceRandom(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// traceValid trace-id 和 parent-id 不能全为 0
+func traceValid(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return false
+	}
+	return n == 2 || strings.Trim(s, "0") != ""
+}
+
+// LoggerExporter 通过 logger 输出 span
+type LoggerExporter struct{}
+
+func (LoggerExporter) Export(s *Span) {
+	logger.Info("trace %v span %v parent %v %v %v %v %v", s.TraceID, s.SpanID, s.ParentID, s.Kind, s.Name, s.Duration, s.Error)
+}
+
+// NewFileExporter 创建文件导出器，每个 span 一行 JSON
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{file: f}, nil
+}
+
+// FileExporter 将 span 写入本地文件
+type FileExporter struct {
+	file  *os.File
+	mutex sync.Mutex
+}
+
+func (e *FileExporter) Export(s *Span) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if _, err = e.file.Write(b); err != nil {
+		logger.Alert("trace export error:%v", err)
+	}
+}
+
+// Close 关闭文件
+func (e *FileExporter) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.file.Close()
+}
@@ -0,0 +1,271 @@
+package cosrpc
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/logger"
+)
+
+// ValidateTag 校验规则使用的结构体标签
+//
+//	type Login struct {
+//		Name  string `json:"name" validate:"required,min=2,max=16"`
+//		Age   int    `json:"age" validate:"min=1,max=150"`
+//		Code  string `json:"code" validate:"len=6,regex=^[0-9]+$"`
+//		Sex   string `json:"sex" validate:"enum=male|female"`
+//	}
+//
+// required: 不能为零值，其他规则只检查非零值，未声明 required 的字段为零值时不校验
+// min/max: 数字比较数值，字符串、切片和 map 比较长度
+// len: 字符串、切片和 map 的长度
+// regex: 字符串匹配正则，必须放在最后
+// enum: 值必须是 | 分隔的选项之一
+const ValidateTag = "validate"
+
+// validator Context.Bind 之后执行的校验器，默认为空，不校验
+var validator Validator
+
+// Validator 请求数据校验器，可以通过 SetValidator 启用或替换规则引擎
+// 校验失败时返回的 error 如果不是 *Error 或 *values.Message，Validate 会使用 ErrCodeValidation 包装
+type Validator interface {
+	Validate(i any) error
+}
+
+// SetValidator 设置校验器，nil 时关闭校验
+//
+//	cosrpc.SetValidator(cosrpc.TagValidator{})
+func SetValidator(v Validator) {
+	validator = v
+}
+
+// Validate 使用当前的校验器校验 i，未设置校验器时不校验
+func Validate(i any) error {
+	if validator == nil {
+		return nil
+	}
+	err := validator.Validate(i)
+	if err == nil {
+		return nil
+	}
+	switch v := err.(type) {
+	case *Error:
+		return v
+	case *values.Message:
+		return v
+	}
+	return NewError(ErrCodeValidation, err.Error())
+}
+
+// TagValidator 执行 ValidateTag 标签中声明的规则
+// 校验失败时返回错误码为 ErrCodeValidation 的 *Error，Details 为不合法的字段及其未通过的规则:
+//
+//	{"name": "required", "code": "len=6,regex=^[0-9]+$"}
+type TagValidator struct{}
+
+func (TagValidator) Validate(i any) error {
+	v := reflect.ValueOf(i)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	errs := map[string][]string{}
+	validateStruct(v, "", errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(errs))
+	for name := range errs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	e := NewError(ErrCodeValidation, "validation failed: "+strings.Join(names, ", "))
+	for _, name := range names {
+		e.WithDetail(name, strings.Join(errs[name], ","))
+	}
+	return e
+}
+
+type validateRule struct {
+	name  string
+	arg   string
+	num   float64
+	re    *regexp.Regexp
+	enums []string
+}
+
+type validateField struct {
+	index  int
+	name   string
+	rules  []*validateRule
+	nested bool
+}
+
+var validateCache sync.Map
+
+func validateFields(t reflect.Type) []*validateField {
+	if v, ok := validateCache.Load(t); ok {
+		return v.([]*validateField)
+	}
+	var fields []*validateField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		f := &validateField{index: i, name: sf.Name}
+		if tag := strings.Split(sf.Tag.Get("json"), ",")[0]; tag != "" && tag != "-" {
+			f.name = tag
+		}
+		f.rules = validateParse(t, sf)
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		f.nested = ft.Kind() == reflect.Struct
+		if len(f.rules) > 0 || f.nested {
+			fields = append(fields, f)
+		}
+	}
+	validateCache.Store(t, fields)
+	return fields
+}
+
+func validateParse(t reflect.Type, sf reflect.StructField) (rules []*validateRule) {
+	tag := sf.Tag.Get(ValidateTag)
+	for tag != "" {
+		var s string
+		if strings.HasPrefix(tag, "regex=") {
+			s, tag = tag, ""
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			s, tag = tag[:i], tag[i+1:]
+		} else {
+			s, tag = tag, ""
+		}
+		r := &validateRule{name: s}
+		if i := strings.Index(s, "="); i >= 0 {
+			r.name, r.arg = s[:i], s[i+1:]
+		}
+		var err error
+		switch r.name {
+		case "required":
+		case "min", "max", "len":
+			r.num, err = strconv.ParseFloat(r.arg, 64)
+		case "regex":
+			r.re, err = regexp.Compile(r.arg)
+		case "enum":
+			r.enums = strings.Split(r.arg, "|")
+		default:
+			err = fmt.Errorf("unknown rule")
+		}
+		if err != nil {
+			logger.Error("validate rule error %v.%v %v:%v", t.String(), sf.Name, s, err)
+			continue
+		}
+		rules = append(rules, r)
+	}
+	return
+}
+
+func validateStruct(v reflect.Value, prefix string, errs map[string][]string) {
+	for _, f := range validateFields(v.Type()) {
+		fv := v.Field(f.index)
+		name := prefix + f.name
+		if !validateValue(fv, name, f.rules, errs) {
+			continue
+		}
+		if f.nested {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			validateStruct(fv, name+".", errs)
+		}
+	}
+}
+
+// validateValue 检查字段规则，返回 false 时不再检查嵌套字段
+func validateValue(v reflect.Value, name string, rules []*validateRule, errs map[string][]string) bool {
+	for _, r := range rules {
+		if r.name == "required" && v.IsZero() {
+			errs[name] = append(errs[name], r.name)
+			return false
+		}
+	}
+	// 其他规则只检查非零值，未填写的可选字段不校验；空指针不再检查嵌套字段
+	if v.IsZero() {
+		return v.Kind() != reflect.Ptr
+	}
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	for _, r := range rules {
+		if r.name != "required" && !r.check(v) {
+			errs[name] = append(errs[name], r.name+"="+r.arg)
+		}
+	}
+	return true
+}
+
+func (r *validateRule) check(v reflect.Value) bool {
+	switch r.name {
+	case "min":
+		n, ok := validateNumber(v)
+		return !ok || n >= r.num
+	case "max":
+		n, ok := validateNumber(v)
+		return !ok || n <= r.num
+	case "len":
+		n, ok := validateLength(v)
+		return !ok || float64(n) == r.num
+	case "regex":
+		return v.Kind() != reflect.String || r.re.MatchString(v.String())
+	case "enum":
+		s := fmt.Sprint(v.Interface())
+		for _, e := range r.enums {
+			if e == s {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// validateNumber 数字返回数值，字符串、切片和 map 返回长度
+func validateNumber(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	n, ok := validateLength(v)
+	return float64(n), ok
+}
+
+func validateLength(v reflect.Value) (int, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(v.String()), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len(), true
+	}
+	return 0, false
+}
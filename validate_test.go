@@ -0,0 +1,113 @@
+package cosrpc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type validateInner struct {
+	Name string `json:"name" validate:"required,min=2"`
+}
+
+type validateArgs struct {
+	Name   string         `json:"name" validate:"required,min=2,max=4"`
+	Age    int            `json:"age" validate:"min=1,max=150"`
+	Code   string         `json:"code" validate:"len=6,regex=^[0-9]{1,6}$"`
+	Sex    string         `json:"sex" validate:"enum=male|female"`
+	Level  *int           `json:"level" validate:"min=1"`
+	Inner  validateInner  `json:"inner"`
+	Option *validateInner `json:"option"`
+	Must   *validateInner `json:"must" validate:"required"`
+}
+
+func validArgs() *validateArgs {
+	return &validateArgs{
+		Name:  "abc",
+		Age:   18,
+		Code:  "123456",
+		Sex:   "male",
+		Inner: validateInner{Name: "abc"},
+		Must:  &validateInner{Name: "abc"},
+	}
+}
+
+func TestTagValidator(t *testing.T) {
+	level := 0
+	tests := []struct {
+		name   string
+		modify func(a *validateArgs)
+		want   map[string]any
+	}{
+		{"valid", func(a *validateArgs) {}, nil},
+		{"required", func(a *validateArgs) { a.Name = "" }, map[string]any{"name": "required"}},
+		{"min max", func(a *validateArgs) { a.Name, a.Age = "abcde", 151 }, map[string]any{"name": "max=4", "age": "max=150"}},
+		{"optional zero", func(a *validateArgs) { a.Age, a.Code, a.Sex = 0, "", "" }, nil},
+		{"regex after len", func(a *validateArgs) { a.Code = "12345a" }, map[string]any{"code": "regex=^[0-9]{1,6}$"}},
+		{"len and regex", func(a *validateArgs) { a.Code = "1234567" }, map[string]any{"code": "len=6,regex=^[0-9]{1,6}$"}},
+		{"enum", func(a *validateArgs) { a.Sex = "x" }, map[string]any{"sex": "enum=male|female"}},
+		{"pointer value", func(a *validateArgs) { a.Level = &level }, map[string]any{"level": "min=1"}},
+		{"nested", func(a *validateArgs) { a.Inner.Name = "a" }, map[string]any{"inner.name": "min=2"}},
+		{"nested nil pointer", func(a *validateArgs) { a.Option = nil }, nil},
+		{"nested pointer", func(a *validateArgs) { a.Option = &validateInner{} }, map[string]any{"option.name": "required"}},
+		{"required pointer", func(a *validateArgs) { a.Must = nil }, map[string]any{"must": "required"}},
+		{"required pointer nested", func(a *validateArgs) { a.Must.Name = "" }, map[string]any{"must.name": "required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := validArgs()
+			tt.modify(args)
+			err := TagValidator{}.Validate(args)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("error %v is not *Error", err)
+			}
+			if e.Code != ErrCodeValidation {
+				t.Errorf("code = %v, want %v", e.Code, ErrCodeValidation)
+			}
+			if !reflect.DeepEqual(e.Details, tt.want) {
+				t.Errorf("details = %v, want %v", e.Details, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagValidatorNotStruct(t *testing.T) {
+	var args *validateArgs
+	for _, i := range []any{nil, args, map[string]any{}, 1} {
+		if err := (TagValidator{}).Validate(i); err != nil {
+			t.Errorf("Validate(%#v) = %v", i, err)
+		}
+	}
+}
+
+type validatorFunc func(i any) error
+
+func (f validatorFunc) Validate(i any) error {
+	return f(i)
+}
+
+func TestValidate(t *testing.T) {
+	defer SetValidator(nil)
+	args := validArgs()
+	args.Name = ""
+	if err := Validate(args); err != nil {
+		t.Fatalf("validation is enabled by default: %v", err)
+	}
+	SetValidator(TagValidator{})
+	if err := Validate(args); err == nil {
+		t.Fatal("want validation error")
+	}
+	SetValidator(validatorFunc(func(any) error { return errors.New("bad request") }))
+	err := Validate(args)
+	var e *Error
+	if !errors.As(err, &e) || e.Code != ErrCodeValidation || e.Message != "bad request" {
+		t.Fatalf("Validate = %#v, want ErrCodeValidation", err)
+	}
+}